@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type RoomRequest struct {
+	ID       int
+	RoomType string
+	CheckIn  time.Time
+	CheckOut time.Time
+}
+
+type stayWindow struct {
+	start, end time.Time
+}
+
+// noNeighbourGap scores the empty side of a room with no stay before or
+// after a request, so that rooms with adjacent stays are preferred.
+const noNeighbourGap = 365 * 24 * time.Hour
+
+// AssignRooms picks a room of the requested type for every request without
+// changing any booking. Requests are placed in check-in order, each into the
+// free room where it leaves the smallest gaps to the stays around it, which
+// keeps free nights together instead of scattering short unbookable gaps.
+func (h *HotelBookingSystem) AssignRooms(requests []RoomRequest) (map[int]*Room, error) {
+	windows := make(map[int][]stayWindow)
+	for _, b := range h.bookings {
+		if b.holdsRoom() && b.hasDates() {
+			windows[b.Room.ID] = append(windows[b.Room.ID], stayWindow{b.CheckInDate, b.CheckOutDate})
+		}
+	}
+
+	ordered := append([]RoomRequest(nil), requests...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].CheckIn.Before(ordered[j].CheckIn)
+	})
+
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+
+	assigned := make(map[int]*Room, len(requests))
+	for _, req := range ordered {
+		if !req.CheckOut.After(req.CheckIn) {
+			return nil, fmt.Errorf("request %d has invalid dates", req.ID)
+		}
+		var best *Room
+		var bestGap time.Duration
+		for _, r := range rooms {
+			if r.Type != req.RoomType || r.UnderMaintenance {
+				continue
+			}
+			gap, free := fitGap(windows[r.ID], req)
+			if free && (best == nil || gap < bestGap) {
+				best, bestGap = r, gap
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("no %s room free for request %d", req.RoomType, req.ID)
+		}
+		assigned[req.ID] = best
+		windows[best.ID] = append(windows[best.ID], stayWindow{req.CheckIn, req.CheckOut})
+	}
+	return assigned, nil
+}
+
+// fitGap reports whether req fits between the given stays and the total free
+// time it leaves next to the closest stays before and after it.
+func fitGap(stays []stayWindow, req RoomRequest) (time.Duration, bool) {
+	before, after := noNeighbourGap, noNeighbourGap
+	for _, w := range stays {
+		if w.start.Before(req.CheckOut) && req.CheckIn.Before(w.end) {
+			return 0, false
+		}
+		if !w.end.After(req.CheckIn) {
+			if gap := req.CheckIn.Sub(w.end); gap < before {
+				before = gap
+			}
+		}
+		if !w.start.Before(req.CheckOut) {
+			if gap := w.start.Sub(req.CheckOut); gap < after {
+				after = gap
+			}
+		}
+	}
+	return before + after, true
+}
+
+// AssignMode tells whether a booking asked for a specific room or only for a
+// room type. Auto-assigned bookings hold a provisional room that may be
+// swapped for another of the same type until the guest checks in.
+type AssignMode string
+
+const (
+	AssignExplicit AssignMode = ""
+	AssignAuto     AssignMode = "auto"
+)
+
+// SelectRoomType selects a provisional room of roomType for the booking in
+// auto mode and returns it.
+func (h *HotelBookingSystem) SelectRoomType(b *Booking, roomType string) (*Room, error) {
+	for _, r := range h.availableRooms(b) {
+		if r.Type != roomType || !b.Preferences.allows(r) {
+			continue
+		}
+		b.Mode = AssignAuto
+		if err := h.Transition(b, EventSelectRoom, r, ""); err != nil {
+			b.Mode = AssignExplicit
+			return nil, err
+		}
+		return b.Room, nil
+	}
+	return nil, fmt.Errorf("no %s rooms available for booking #%d", roomType, b.ID)
+}
+
+type roomMove struct {
+	booking *Booking
+	to      *Room
+}
+
+// makeRoomFor moves auto-assigned bookings that provisionally hold room over
+// the stay of b to other free rooms of the same type, so that b can take the
+// room explicitly. Bookings already checked in stay where they are. Nothing
+// is moved unless every such booking has somewhere to go.
+func (h *HotelBookingSystem) makeRoomFor(room *Room, b *Booking) error {
+	if room == nil || b.Mode == AssignAuto {
+		return nil
+	}
+	var moves []roomMove
+	for _, other := range h.sortedBookings() {
+		if other == b || other.Mode != AssignAuto || other.State == StateCheckedIn ||
+			!other.holdsRoom() || other.Room.ID != room.ID || !other.overlaps(b) {
+			continue
+		}
+		var moved *Room
+		for _, r := range h.availableRooms(other) {
+			if r.ID != room.ID && r.Type == other.Room.Type && other.Preferences.allows(r) {
+				moved = r
+				break
+			}
+		}
+		if moved == nil {
+			return fmt.Errorf("room %d is held by booking #%d and no other %s room is free", room.ID, other.ID, other.Room.Type)
+		}
+		moves = append(moves, roomMove{other, moved})
+	}
+	for _, m := range moves {
+		m.booking.Room = m.to
+		fmt.Printf("Booking #%d: moved to room %d\n", m.booking.ID, m.to.ID)
+	}
+	return nil
+}
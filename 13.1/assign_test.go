@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// shortGaps counts the free gaps between consecutive stays on each room that
+// are shorter than minNights and so cannot be sold.
+func shortGaps(stays map[int][]stayWindow, minNights int) int {
+	gaps := 0
+	for _, windows := range stays {
+		sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+		for i := 1; i < len(windows); i++ {
+			gap := windows[i].start.Sub(windows[i-1].end)
+			if gap > 0 && gap < time.Duration(minNights)*24*time.Hour {
+				gaps++
+			}
+		}
+	}
+	return gaps
+}
+
+// naiveAssign puts each request into the free room of its type with the
+// lowest ID, in the order given.
+func naiveAssign(rooms []*Room, stays map[int][]stayWindow, requests []RoomRequest) map[int][]stayWindow {
+	result := make(map[int][]stayWindow)
+	for id, w := range stays {
+		result[id] = append([]stayWindow(nil), w...)
+	}
+	for _, req := range requests {
+		for _, r := range rooms {
+			if _, free := fitGap(result[r.ID], req); free && r.Type == req.RoomType {
+				result[r.ID] = append(result[r.ID], stayWindow{req.CheckIn, req.CheckOut})
+				break
+			}
+		}
+	}
+	return result
+}
+
+func TestAssignRoomsLeavesFewerGapsThanFirstFit(t *testing.T) {
+	h, _ := newTestSystem()
+	a := addRoom(t, h, &Room{ID: 1, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 2, Type: "standard", Price: 5000})
+	c := addRoom(t, h, &Room{ID: 3, Type: "standard", Price: 5000})
+	payStay(t, h, 1, a, 0, 3)
+	payStay(t, h, 2, b, 0, 4)
+	payStay(t, h, 3, c, 0, 5)
+	stays := map[int][]stayWindow{
+		a.ID: {{day(0), day(3)}},
+		b.ID: {{day(0), day(4)}},
+		c.ID: {{day(0), day(5)}},
+	}
+	requests := []RoomRequest{
+		{ID: 1, RoomType: "standard", CheckIn: day(4), CheckOut: day(6)},
+		{ID: 2, RoomType: "standard", CheckIn: day(5), CheckOut: day(8)},
+	}
+
+	naive := naiveAssign([]*Room{a, b, c}, stays, requests)
+	if got := shortGaps(naive, 2); got != 2 {
+		t.Fatalf("first-fit left %d one-night gaps, want 2 for this scenario", got)
+	}
+
+	assigned, err := h.AssignRooms(requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assigned[1] != b || assigned[2] != c {
+		t.Errorf("assigned rooms %d and %d, want %d and %d", assigned[1].ID, assigned[2].ID, b.ID, c.ID)
+	}
+	best := make(map[int][]stayWindow)
+	for id, w := range stays {
+		best[id] = append([]stayWindow(nil), w...)
+	}
+	for _, req := range requests {
+		best[assigned[req.ID].ID] = append(best[assigned[req.ID].ID], stayWindow{req.CheckIn, req.CheckOut})
+	}
+	if got := shortGaps(best, 2); got != 0 {
+		t.Errorf("AssignRooms left %d one-night gaps, want 0", got)
+	}
+	if len(h.auditFor(4)) != 0 || len(h.bookings) != 3 {
+		t.Error("AssignRooms changed the bookings")
+	}
+}
+
+func TestAssignRoomsFailsWhenFull(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 1, Type: "standard", Price: 5000})
+	payStay(t, h, 1, room, 0, 5)
+	if _, err := h.AssignRooms([]RoomRequest{{ID: 1, RoomType: "standard", CheckIn: day(2), CheckOut: day(3)}}); err == nil {
+		t.Error("request assigned to a full room")
+	}
+}
+
+func TestExplicitSelectionMovesAutoBookings(t *testing.T) {
+	h, _ := newTestSystem()
+	first := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	second := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+
+	auto, err := h.NewBooking(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auto.CheckInDate, auto.CheckOutDate = day(5), day(8)
+	room, err := h.SelectRoomType(auto, "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room != first || auto.Mode != AssignAuto {
+		t.Fatalf("SelectRoomType gave room %d in mode %q, want 101 in auto mode", room.ID, auto.Mode)
+	}
+
+	explicit := selectStay(t, h, 2, first, 6, 2)
+	if explicit.Room != first || auto.Room != second {
+		t.Fatalf("explicit in room %d, auto in room %d; want 101 and 102", explicit.Room.ID, auto.Room.ID)
+	}
+
+	// The explicit booking keeps its room, so the auto booking has nowhere to go.
+	late, err := h.NewBooking(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late.CheckInDate, late.CheckOutDate = day(6), day(7)
+	if err := h.Transition(late, EventSelectRoom, second, ""); err == nil {
+		t.Error("selecting the auto booking's room succeeded with no other room free")
+	}
+	if explicit.Room != first || auto.Room != second {
+		t.Errorf("after failed selection: explicit in room %d, auto in room %d", explicit.Room.ID, auto.Room.ID)
+	}
+}
+
+func TestExplicitSelectionMovesNothingUnlessAllCanMove(t *testing.T) {
+	h, _ := newTestSystem()
+	first := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	second := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	auto := func(userID, from, nights int) *Booking {
+		b, err := h.NewBooking(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.CheckInDate, b.CheckOutDate = day(from), day(from+nights)
+		if _, err := h.SelectRoomType(b, "standard"); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	movable := auto(1, 5, 2)
+	stuck := auto(2, 7, 2)
+	selectStay(t, h, 3, second, 7, 2)
+
+	// The first auto booking could move to 102, but the second cannot.
+	wide, err := h.NewBooking(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wide.CheckInDate, wide.CheckOutDate = day(5), day(9)
+	if err := h.Transition(wide, EventSelectRoom, first, ""); err == nil {
+		t.Fatal("selecting room 101 succeeded with a booking left nowhere to go")
+	}
+	if movable.Room != first || stuck.Room != first {
+		t.Errorf("auto bookings in rooms %d and %d after the failed selection, want both still in 101",
+			movable.Room.ID, stuck.Room.ID)
+	}
+}
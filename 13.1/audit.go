@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// AuditEntry records a single committed state change.
+type AuditEntry struct {
+	BookingID int
+	Event     BookingEvent
+	From      BookingState
+	To        BookingState
+	At        time.Time
+}
+
+func (h *HotelBookingSystem) auditFor(bookingID int) []AuditEntry {
+	var entries []AuditEntry
+	for _, e := range h.audit {
+		if e.BookingID == bookingID {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// StateDurations returns how long the booking spent in each state, starting
+// from its creation in Idle. Time in the current state is counted up to the
+// current time of Clock.
+func (h *HotelBookingSystem) StateDurations(b *Booking) map[BookingState]time.Duration {
+	durations := make(map[BookingState]time.Duration)
+	state, since := StateIdle, b.CreatedAt
+	for _, e := range h.auditFor(b.ID) {
+		durations[state] += e.At.Sub(since)
+		state, since = e.To, e.At
+	}
+	durations[state] += h.now().Sub(since)
+	return durations
+}
+
+// RebuildHistoryFromAudit reconstructs the booking history from the audit
+// log, adding bookings in the order they first reached Paid or Cancelled.
+func (h *HotelBookingSystem) RebuildHistoryFromAudit() (*BookingHistory, error) {
+	history := &BookingHistory{}
+	for _, e := range h.audit {
+		if e.To != StatePaid && e.To != StateBookingCancelled {
+			continue
+		}
+		if history.find(e.BookingID) != nil {
+			continue
+		}
+		b, ok := h.bookings[e.BookingID]
+		if !ok {
+			return nil, fmt.Errorf("audit entry refers to unknown booking #%d", e.BookingID)
+		}
+		history.Add(b)
+	}
+	return history, nil
+}
+
+// FunnelRates returns the share of bookings that went on to confirmation
+// after selecting a room, and to payment after confirmation, based on the
+// audit log.
+func (h *HotelBookingSystem) FunnelRates() (selectedToConfirmed, confirmedToPaid float64) {
+	reached := map[BookingState]map[int]bool{
+		StateRoomSelected:     {},
+		StateBookingConfirmed: {},
+		StatePaid:             {},
+	}
+	for _, e := range h.audit {
+		if ids, ok := reached[e.To]; ok {
+			ids[e.BookingID] = true
+		}
+	}
+	selected := len(reached[StateRoomSelected])
+	confirmed := len(reached[StateBookingConfirmed])
+	paid := len(reached[StatePaid])
+	if selected > 0 {
+		selectedToConfirmed = float64(confirmed) / float64(selected)
+	}
+	if confirmed > 0 {
+		confirmedToPaid = float64(paid) / float64(confirmed)
+	}
+	return selectedToConfirmed, confirmedToPaid
+}
+
+type auditRecord struct {
+	BookingID int          `json:"bookingId"`
+	Event     BookingEvent `json:"event"`
+	From      BookingState `json:"from"`
+	To        BookingState `json:"to"`
+	At        string       `json:"at"`
+}
+
+// ExportAuditJSONL writes the audit log to w as one JSON object per line,
+// with RFC3339 timestamps.
+func (h *HotelBookingSystem) ExportAuditJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, e := range h.audit {
+		record := auditRecord{
+			BookingID: e.BookingID,
+			Event:     e.Event,
+			From:      e.From,
+			To:        e.To,
+			At:        e.At.Format(time.RFC3339),
+		}
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("export audit entry for booking #%d: %w", e.BookingID, err)
+		}
+	}
+	return nil
+}
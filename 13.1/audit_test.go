@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateDurationsFollowClock(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b, _ := h.NewBooking(1)
+	b.CheckInDate, b.CheckOutDate = day(10), day(11)
+
+	clock.Advance(5 * time.Minute)
+	mustTransition(t, h, b, EventSelectRoom, room, "")
+	clock.Advance(20 * time.Minute)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	clock.Advance(2 * time.Hour)
+	mustTransition(t, h, b, EventPay, nil, "")
+	clock.Advance(3 * time.Hour)
+
+	got := h.StateDurations(b)
+	want := map[BookingState]time.Duration{
+		StateIdle:             5 * time.Minute,
+		StateRoomSelected:     20 * time.Minute,
+		StateBookingConfirmed: 2 * time.Hour,
+		StatePaid:             3 * time.Hour,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("StateDurations = %v, want %v", got, want)
+	}
+	for state, d := range want {
+		if got[state] != d {
+			t.Errorf("time in %s = %s, want %s", state, got[state], d)
+		}
+	}
+}
+
+func TestRebuildHistoryFromAudit(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	payStay(t, h, 1, room, 10, 1)
+	cancelled := selectStay(t, h, 2, room, 12, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+	selectStay(t, h, 3, room, 14, 1)
+	refunded := payStay(t, h, 4, room, 16, 1)
+	mustTransition(t, h, refunded, EventRefund, nil, "")
+
+	original := h.history.Bookings
+	h.history = &BookingHistory{}
+	rebuilt, err := h.RebuildHistoryFromAudit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rebuilt.Bookings) != len(original) {
+		t.Fatalf("rebuilt %d bookings, want %d", len(rebuilt.Bookings), len(original))
+	}
+	for i, b := range original {
+		if rebuilt.Bookings[i] != b {
+			t.Errorf("rebuilt[%d] = #%d, want #%d", i, rebuilt.Bookings[i].ID, b.ID)
+		}
+	}
+}
+
+func TestRebuildHistoryFromAuditUnknownBooking(t *testing.T) {
+	h, _ := newTestSystem()
+	h.audit = append(h.audit, AuditEntry{BookingID: 42, Event: EventPay, From: StateBookingConfirmed, To: StatePaid})
+	if _, err := h.RebuildHistoryFromAudit(); err == nil {
+		t.Error("rebuilt a history from an entry for an unknown booking")
+	}
+}
+
+func TestFunnelRates(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	for i := 0; i < 2; i++ {
+		payStay(t, h, i, room, 10+i, 1)
+	}
+	confirmed := selectStay(t, h, 3, room, 20, 1)
+	mustTransition(t, h, confirmed, EventConfirmBooking, nil, "")
+	selectStay(t, h, 4, room, 30, 1)
+	abandoned := selectStay(t, h, 5, room, 40, 1)
+	mustTransition(t, h, abandoned, EventCancel, nil, "")
+
+	selected, paid := h.FunnelRates()
+	if selected != 0.6 || paid != 2.0/3 {
+		t.Errorf("FunnelRates = %v, %v; want 0.6, 0.667", selected, paid)
+	}
+}
+
+func TestExportAuditJSONL(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	clock.Advance(time.Hour)
+	mustTransition(t, h, b, EventCancel, nil, "")
+
+	var buf bytes.Buffer
+	if err := h.ExportAuditJSONL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("exported %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	want := []auditRecord{
+		{BookingID: b.ID, Event: EventSelectRoom, From: StateIdle, To: StateRoomSelected, At: "2026-03-02T09:00:00Z"},
+		{BookingID: b.ID, Event: EventCancel, From: StateRoomSelected, To: StateBookingCancelled, At: "2026-03-02T10:00:00Z"},
+	}
+	for i, line := range lines {
+		var got auditRecord
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i+1, err)
+		}
+		if got != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i+1, got, want[i])
+		}
+		if _, err := time.Parse(time.RFC3339, got.At); err != nil {
+			t.Errorf("line %d timestamp %q is not RFC3339", i+1, got.At)
+		}
+	}
+}
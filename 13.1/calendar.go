@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// dayOf returns the calendar date of t as midnight UTC, suitable as a map key.
+// Blackout dates are stored by their own calendar date.
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// localDay returns the calendar date of t in the hotel's time zone.
+func (h *HotelBookingSystem) localDay(t time.Time) time.Time {
+	return dayOf(t.In(h.Location))
+}
+
+// Nights returns the number of nights of the booking's stay, counted by
+// calendar dates in the hotel's time zone, or zero when the dates are not set.
+func (h *HotelBookingSystem) Nights(b *Booking) int {
+	if !b.hasDates() {
+		return 0
+	}
+	return int(h.localDay(b.CheckOutDate).Sub(h.localDay(b.CheckInDate)).Hours() / 24)
+}
+
+// stayDays returns each night of the booking's stay by its calendar date in
+// the hotel's time zone. For hourly bookings it returns every day the
+// booking touches.
+func (h *HotelBookingSystem) stayDays(b *Booking) []time.Time {
+	var days []time.Time
+	if !b.hasDates() {
+		return days
+	}
+	last := h.localDay(b.CheckOutDate)
+	if b.Kind == KindHourly {
+		last = h.localDay(b.CheckOutDate.Add(-time.Nanosecond)).AddDate(0, 0, 1)
+	}
+	for d := h.localDay(b.CheckInDate); d.Before(last); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+func (h *HotelBookingSystem) AddBlackoutDate(date time.Time) {
+	h.blackoutDates[dayOf(date)] = true
+}
+
+func (h *HotelBookingSystem) RemoveBlackoutDate(date time.Time) {
+	delete(h.blackoutDates, dayOf(date))
+}
+
+func (h *HotelBookingSystem) checkBlackout(b *Booking) error {
+	for _, d := range h.stayDays(b) {
+		if h.blackoutDates[d] {
+			return fmt.Errorf("%w: %s", ErrBlackoutDate, d.Format(dateLayout))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlackoutDateBlocksConfirmation(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	h.AddBlackoutDate(day(11))
+
+	b := selectStay(t, h, 1, room, 10, 3)
+	err := h.Transition(b, EventConfirmBooking, nil, "")
+	if !errors.Is(err, ErrBlackoutDate) {
+		t.Fatalf("confirm error = %v, want %v", err, ErrBlackoutDate)
+	}
+	if !strings.Contains(err.Error(), day(11).Format(dateLayout)) {
+		t.Errorf("error %q does not name the blackout date", err)
+	}
+
+	// The check-out day is not a night of the stay.
+	other := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	mustTransition(t, h, selectStay(t, h, 2, other, 9, 2), EventConfirmBooking, nil, "")
+
+	h.RemoveBlackoutDate(day(11))
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+}
+
+func TestNightsCountedInHotelTimeZone(t *testing.T) {
+	h, _ := newTestSystem()
+	h.Location = time.FixedZone("MSK", 3*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	// 10 March 18:00 to 12 March 14:00 in New York is 11 March 02:00 to
+	// 12 March 22:00 at the hotel: a single night.
+	b, _ := h.NewBooking(1)
+	b.CheckInDate = time.Date(2026, 3, 10, 18, 0, 0, 0, newYork)
+	b.CheckOutDate = time.Date(2026, 3, 12, 14, 0, 0, 0, newYork)
+	if got := h.Nights(b); got != 1 {
+		t.Errorf("Nights = %d, want 1 in hotel time", got)
+	}
+	days := h.stayDays(b)
+	if len(days) != 1 || !days[0].Equal(time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("stayDays = %v, want [2026-03-11]", days)
+	}
+
+	h.AddBlackoutDate(time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC))
+	mustTransition(t, h, b, EventSelectRoom, room, "")
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+}
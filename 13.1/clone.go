@@ -0,0 +1,111 @@
+package main
+
+import "time"
+
+// Clone returns a deep copy of the system: inventory, bookings, history,
+// audit log and configuration. Guards and state actions are shared, since
+// functions cannot be copied. The clone has no notifier, so what-if runs on it
+// never contact guests.
+func (h *HotelBookingSystem) Clone() *HotelBookingSystem {
+	c := *h
+	c.notifier = nil
+	c.WeekendDays = append([]time.Weekday(nil), h.WeekendDays...)
+
+	rooms := make(map[*Room]*Room)
+	cloneRoom := func(r *Room) *Room {
+		if r == nil {
+			return nil
+		}
+		if cr, ok := rooms[r]; ok {
+			return cr
+		}
+		cr := *r
+		rooms[r] = &cr
+		return &cr
+	}
+	c.rooms = make(map[int]*Room, len(h.rooms))
+	for id, r := range h.rooms {
+		c.rooms[id] = cloneRoom(r)
+	}
+
+	cards := make(map[*GiftCard]*GiftCard)
+	cloneCard := func(g *GiftCard) *GiftCard {
+		if g == nil {
+			return nil
+		}
+		if cg, ok := cards[g]; ok {
+			return cg
+		}
+		cg := *g
+		cards[g] = &cg
+		return &cg
+	}
+
+	bookings := make(map[*Booking]*Booking)
+	cloneBooking := func(b *Booking) *Booking {
+		if cb, ok := bookings[b]; ok {
+			return cb
+		}
+		cb := *b
+		cb.Room = cloneRoom(b.Room)
+		cb.GiftCard = cloneCard(b.GiftCard)
+		cb.GuestAges = append([]int(nil), b.GuestAges...)
+		cb.AddOns = append([]AddOn(nil), b.AddOns...)
+		cb.Credits = append([]Credit(nil), b.Credits...)
+		if b.Metadata != nil {
+			cb.Metadata = make(map[string]string, len(b.Metadata))
+			for k, v := range b.Metadata {
+				cb.Metadata[k] = v
+			}
+		}
+		bookings[b] = &cb
+		return &cb
+	}
+	c.bookings = make(map[int]*Booking, len(h.bookings))
+	for id, b := range h.bookings {
+		c.bookings[id] = cloneBooking(b)
+	}
+	c.references = make(map[string]int, len(h.references))
+	for ref, id := range h.references {
+		c.references[ref] = id
+	}
+	c.history = &BookingHistory{}
+	for _, b := range h.history.Bookings {
+		c.history.Add(cloneBooking(b))
+	}
+
+	c.promoCodes = make(map[string]*PromoCode, len(h.promoCodes))
+	for code, p := range h.promoCodes {
+		cp := p.copy()
+		c.promoCodes[code] = &cp
+	}
+	c.guards = append([]Guard(nil), h.guards...)
+	c.middleware = append([]Middleware(nil), h.middleware...)
+	c.entryActions = make(map[BookingState]StateAction, len(h.entryActions))
+	for state, action := range h.entryActions {
+		c.entryActions[state] = action
+	}
+	c.templates = make(map[BookingState]notificationTemplate, len(h.templates))
+	for state, t := range h.templates {
+		c.templates[state] = t
+	}
+	c.timeouts = make(map[BookingState]StateTimeout, len(h.timeouts))
+	for state, t := range h.timeouts {
+		c.timeouts[state] = t
+	}
+	c.audit = append([]AuditEntry(nil), h.audit...)
+	c.upgrades = append([]UpgradeRequest(nil), h.upgrades...)
+	c.blackoutDates = make(map[time.Time]bool, len(h.blackoutDates))
+	for d := range h.blackoutDates {
+		c.blackoutDates[d] = true
+	}
+	c.userTiers = make(map[int]LoyaltyTier, len(h.userTiers))
+	for id, tier := range h.userTiers {
+		c.userTiers[id] = tier
+	}
+	c.userPoints = make(map[int]int, len(h.userPoints))
+	for id, points := range h.userPoints {
+		c.userPoints[id] = points
+	}
+	return &c
+}
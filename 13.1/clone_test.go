@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	paid := payStay(t, h, 1, room, 10, 1)
+	paid.SetMeta("source", "web")
+	pending := selectStay(t, h, 2, room, 12, 1)
+	auditLen := len(h.audit)
+
+	c := h.Clone()
+	c.rooms[101].Price = 9000
+	c.bookings[paid.ID].SetMeta("source", "import")
+	c.bookings[paid.ID].Total = 1
+	c.promoCodes["LOYALTY10"].Uses = 50
+	c.DefaultDiscountPercent = 25
+	if _, err := c.SetRoomTypePrice("standard", 7000); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, c, c.bookings[pending.ID], EventConfirmBooking, nil, "")
+	mustTransition(t, c, c.bookings[pending.ID], EventPay, nil, "")
+
+	if room.Price != 5000 {
+		t.Errorf("original room price = %.2f, want 5000", room.Price)
+	}
+	if v, _ := paid.GetMeta("source"); v != "web" || paid.Total != 5000 {
+		t.Errorf("original booking source %q, total %.2f; want web, 5000", v, paid.Total)
+	}
+	if pending.State != StateRoomSelected || len(h.audit) != auditLen || len(h.history.Bookings) != 1 {
+		t.Errorf("original state %s, %d audit entries, %d in history; want unchanged",
+			pending.State, len(h.audit), len(h.history.Bookings))
+	}
+	if h.promoCodes["LOYALTY10"].Uses != 0 || h.DefaultDiscountPercent != 0 {
+		t.Error("changes to the clone's promo codes or configuration reached the original")
+	}
+	if c.history.Bookings[0] != c.bookings[paid.ID] {
+		t.Error("clone history does not share bookings with the clone registry")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// liveTransitions returns the transition table together with the timeout
+// edges configured on this system.
+func (h *HotelBookingSystem) liveTransitions() map[BookingState]map[BookingEvent]BookingState {
+	live := make(map[BookingState]map[BookingEvent]BookingState, len(transitions))
+	for from, byEvent := range transitions {
+		live[from] = make(map[BookingEvent]BookingState, len(byEvent)+1)
+		for event, to := range byEvent {
+			live[from][event] = to
+		}
+	}
+	for from, timeout := range h.timeouts {
+		if live[from] == nil {
+			live[from] = make(map[BookingEvent]BookingState, 1)
+		}
+		live[from][EventTimeout] = timeout.To
+	}
+	return live
+}
+
+// ExportMermaid renders the transition table, including configured timeouts,
+// as a Mermaid state diagram.
+func (h *HotelBookingSystem) ExportMermaid() string {
+	var sb strings.Builder
+	sb.WriteString("stateDiagram-v2\n")
+	fmt.Fprintf(&sb, "    [*] --> %s\n", StateIdle)
+
+	live := h.liveTransitions()
+	states := make([]string, 0, len(live))
+	for from := range live {
+		states = append(states, string(from))
+	}
+	sort.Strings(states)
+
+	for _, from := range states {
+		byEvent := live[BookingState(from)]
+		events := make([]string, 0, len(byEvent))
+		for event := range byEvent {
+			events = append(events, string(event))
+		}
+		sort.Strings(events)
+		for _, event := range events {
+			fmt.Fprintf(&sb, "    %s --> %s : %s\n", from, byEvent[BookingEvent(event)], event)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportMermaid(t *testing.T) {
+	h, _ := newTestSystem()
+	got := h.ExportMermaid()
+	for _, want := range []string{
+		"stateDiagram-v2\n",
+		"    [*] --> Idle\n",
+		"    Idle --> RoomSelected : selectRoom\n",
+		"    BookingConfirmed --> Paid : pay\n",
+		"    Paid --> Disputed : dispute\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ExportMermaid is missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "timeout") {
+		t.Errorf("ExportMermaid shows a timeout none was configured:\n%s", got)
+	}
+
+	if err := h.SetStateTimeout(StateBookingConfirmed, time.Hour, StateRoomSelected); err != nil {
+		t.Fatal(err)
+	}
+	if want := "    BookingConfirmed --> RoomSelected : timeout\n"; !strings.Contains(h.ExportMermaid(), want) {
+		t.Errorf("ExportMermaid is missing the configured timeout %q", want)
+	}
+}
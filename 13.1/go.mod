@@ -0,0 +1,3 @@
+module hotelbooking
+
+go 1.22
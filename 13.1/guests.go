@@ -0,0 +1,67 @@
+package main
+
+type AgeBand string
+
+const (
+	BandInfant AgeBand = "infant"
+	BandChild  AgeBand = "child"
+	BandAdult  AgeBand = "adult"
+)
+
+// AgeBands sets the age limits of each band and the per-stay charge for
+// every guest in it on top of the room price. Infants take a capacity place
+// only when InfantsUseCapacity is set.
+type AgeBands struct {
+	InfantMaxAge       int
+	ChildMaxAge        int
+	InfantsUseCapacity bool
+
+	InfantPrice float64
+	ChildPrice  float64
+	AdultPrice  float64
+}
+
+func (a AgeBands) bandOf(age int) AgeBand {
+	switch {
+	case age <= a.InfantMaxAge:
+		return BandInfant
+	case age <= a.ChildMaxAge:
+		return BandChild
+	default:
+		return BandAdult
+	}
+}
+
+func (a AgeBands) priceOf(band AgeBand) float64 {
+	switch band {
+	case BandInfant:
+		return a.InfantPrice
+	case BandChild:
+		return a.ChildPrice
+	default:
+		return a.AdultPrice
+	}
+}
+
+// CapacityUsed returns the number of room places the booking's guests take.
+// Without guest ages every guest counts as one place.
+func (h *HotelBookingSystem) CapacityUsed(b *Booking) int {
+	if len(b.GuestAges) == 0 {
+		return b.Guests
+	}
+	used := 0
+	for _, age := range b.GuestAges {
+		if h.AgeBands.bandOf(age) != BandInfant || h.AgeBands.InfantsUseCapacity {
+			used++
+		}
+	}
+	return used
+}
+
+func (h *HotelBookingSystem) guestCharges(b *Booking) float64 {
+	total := 0.0
+	for _, age := range b.GuestAges {
+		total += h.AgeBands.priceOf(h.AgeBands.bandOf(age))
+	}
+	return total
+}
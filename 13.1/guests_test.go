@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInfantDoesNotUseCapacity(t *testing.T) {
+	h, _ := newTestSystem()
+	h.AgeBands.InfantPrice = 0
+	h.AgeBands.ChildPrice = 500
+	h.AgeBands.AdultPrice = 1000
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000, Capacity: 3})
+
+	b, _ := h.NewBooking(1)
+	b.CheckInDate, b.CheckOutDate = day(10), day(11)
+	b.GuestAges = []int{35, 33, 8, 1}
+	b.Contact = "family@example.com"
+	mustTransition(t, h, b, EventSelectRoom, room, "")
+
+	if used := h.CapacityUsed(b); used != 3 {
+		t.Errorf("CapacityUsed = %d, want 3 with the infant not counted", used)
+	}
+	if errs := h.Validate(b); len(errs) != 0 {
+		t.Errorf("Validate = %v, want the family to fit", errs)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	if want := 5000.0 + 2*1000 + 500; b.Total != want {
+		t.Errorf("Total = %.2f, want %.2f", b.Total, want)
+	}
+
+	h.AgeBands.InfantsUseCapacity = true
+	if used := h.CapacityUsed(b); used != 4 {
+		t.Errorf("CapacityUsed with infants counted = %d, want 4", used)
+	}
+}
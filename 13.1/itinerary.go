@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// Itinerary is a guest's stay split over consecutive bookings, each leg
+// checking in on the date the previous one checks out.
+type Itinerary struct {
+	Legs []*Booking
+}
+
+// NewItinerary validates that legs belong to one user and follow each other
+// without gaps or overlaps, compared by hotel-local date.
+func (h *HotelBookingSystem) NewItinerary(legs ...*Booking) (*Itinerary, error) {
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("itinerary needs at least one leg")
+	}
+	for i, leg := range legs {
+		if !leg.hasDates() {
+			return nil, fmt.Errorf("booking #%d has no stay dates", leg.ID)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := legs[i-1]
+		if leg.UserID != prev.UserID {
+			return nil, fmt.Errorf("booking #%d belongs to another user", leg.ID)
+		}
+		out, in := h.localDay(prev.CheckOutDate), h.localDay(leg.CheckInDate)
+		if in.After(out) {
+			return nil, fmt.Errorf("gap between booking #%d and #%d: %s to %s",
+				prev.ID, leg.ID, out.Format(dateLayout), in.Format(dateLayout))
+		}
+		if in.Before(out) {
+			return nil, fmt.Errorf("booking #%d overlaps booking #%d", leg.ID, prev.ID)
+		}
+	}
+	return &Itinerary{Legs: legs}, nil
+}
+
+// ItineraryTotal sums the paid total of each paid leg and the current
+// subtotal of the others.
+func (h *HotelBookingSystem) ItineraryTotal(it *Itinerary) float64 {
+	total := 0.0
+	for _, leg := range it.Legs {
+		if leg.PaidAt.IsZero() {
+			total += h.subtotal(leg)
+		} else {
+			total += leg.Total
+		}
+	}
+	return RoundMoney(total, h.Currency)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTwoLegItinerary(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	suite := addRoom(t, h, &Room{ID: 301, Type: "suite", Price: 20000})
+	first := payStay(t, h, 1, standard, 10, 2)
+	second := selectStay(t, h, 1, suite, 12, 3)
+
+	it, err := h.NewItinerary(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.ItineraryTotal(it); got != 10000+60000 {
+		t.Errorf("ItineraryTotal = %.2f, want 70000", got)
+	}
+}
+
+func TestItineraryRejectsGapsAndOverlaps(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	suite := addRoom(t, h, &Room{ID: 301, Type: "suite", Price: 20000})
+	first := selectStay(t, h, 1, standard, 10, 2)
+
+	gap := selectStay(t, h, 1, suite, 13, 3)
+	if _, err := h.NewItinerary(first, gap); err == nil {
+		t.Error("itinerary with a one-night gap accepted")
+	}
+	overlap := selectStay(t, h, 1, suite, 11, 3)
+	if _, err := h.NewItinerary(first, overlap); err == nil {
+		t.Error("overlapping itinerary accepted")
+	}
+	other := selectStay(t, h, 2, suite, 12, 3)
+	if _, err := h.NewItinerary(first, other); err == nil {
+		t.Error("itinerary across two users accepted")
+	}
+}
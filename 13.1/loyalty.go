@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type LoyaltyTier string
+
+const (
+	TierBasic  LoyaltyTier = "basic"
+	TierSilver LoyaltyTier = "silver"
+	TierGold   LoyaltyTier = "gold"
+)
+
+const (
+	// defaultPointValue is the amount of currency one loyalty point is worth.
+	defaultPointValue = 1.0
+	// defaultPointsPerUnit earns one point for every 100 units paid.
+	defaultPointsPerUnit = 0.01
+)
+
+// PointsRounding decides how fractional points earned on a payment are
+// turned into whole points.
+type PointsRounding string
+
+const (
+	PointsFloor PointsRounding = "floor"
+	PointsRound PointsRounding = "round"
+	PointsCeil  PointsRounding = "ceil"
+)
+
+// roomTypeOrder lists room types from the lowest to the highest category.
+var roomTypeOrder = []string{"standard", "deluxe", "suite"}
+
+func nextRoomType(roomType string) string {
+	for i, t := range roomTypeOrder {
+		if t == roomType && i+1 < len(roomTypeOrder) {
+			return roomTypeOrder[i+1]
+		}
+	}
+	return ""
+}
+
+func (h *HotelBookingSystem) SetUserTier(userID int, tier LoyaltyTier) {
+	h.userTiers[userID] = tier
+}
+
+func (h *HotelBookingSystem) UserTier(userID int) LoyaltyTier {
+	if tier, ok := h.userTiers[userID]; ok {
+		return tier
+	}
+	return TierBasic
+}
+
+// freeUpgrade returns an available room one category above the booking's
+// room for gold members, or nil when no upgrade applies.
+func (h *HotelBookingSystem) freeUpgrade(b *Booking) *Room {
+	if h.UserTier(b.UserID) != TierGold || b.Room == nil {
+		return nil
+	}
+	target := nextRoomType(b.Room.Type)
+	if target == "" {
+		return nil
+	}
+	for _, r := range h.availableRooms(b) {
+		if r.Type == target && b.Preferences.allows(r) {
+			return r
+		}
+	}
+	return nil
+}
+
+// pointsFor returns the points earned by paying amount.
+func (h *HotelBookingSystem) pointsFor(amount float64) int {
+	points := amount * h.PointsPerUnit
+	switch h.PointsRounding {
+	case PointsRound:
+		points = math.Round(points)
+	case PointsCeil:
+		points = math.Ceil(points)
+	default:
+		points = math.Floor(points)
+	}
+	if points < 0 {
+		return 0
+	}
+	return int(points)
+}
+
+func (h *HotelBookingSystem) AddPoints(userID, points int) {
+	h.userPoints[userID] += points
+}
+
+func (h *HotelBookingSystem) Points(userID int) int {
+	return h.userPoints[userID]
+}
+
+// RedeemPoints sets how many of the user's points the booking redeems when
+// it is paid. The points are taken at payment, and only as many as needed
+// to bring the total down to zero.
+func (h *HotelBookingSystem) RedeemPoints(b *Booking, points int) error {
+	if b.State != StateRoomSelected && b.State != StateBookingConfirmed {
+		return fmt.Errorf("points can only be redeemed on a booking awaiting payment")
+	}
+	if points <= 0 {
+		return fmt.Errorf("points to redeem must be positive, got %d", points)
+	}
+	if h.PointValue <= 0 {
+		return fmt.Errorf("point value must be positive, got %.2f", h.PointValue)
+	}
+	if balance := h.userPoints[b.UserID]; points > balance {
+		return fmt.Errorf("user %d has %d points, cannot redeem %d", b.UserID, balance, points)
+	}
+	b.PointsRedeemed = points
+	return nil
+}
+
+// pointsDiscount returns how many of the points set on the booking can be
+// used against total, limited by the user's balance, and what they are worth.
+func (h *HotelBookingSystem) pointsDiscount(b *Booking, total float64) (int, float64) {
+	points := b.PointsRedeemed
+	if balance := h.userPoints[b.UserID]; points > balance {
+		points = balance
+	}
+	if points <= 0 || h.PointValue <= 0 {
+		return 0, 0
+	}
+	if needed := int(math.Ceil(total / h.PointValue)); points > needed {
+		points = needed
+	}
+	return points, math.Min(total, RoundMoney(float64(points)*h.PointValue, h.Currency))
+}
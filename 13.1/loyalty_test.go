@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGoldMemberGetsFreeUpgrade(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	deluxe := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	h.SetUserTier(1, TierGold)
+
+	b := payStay(t, h, 1, standard, 10, 2)
+	if b.Room != deluxe {
+		t.Errorf("gold member got room %d, want deluxe %d", b.Room.ID, deluxe.ID)
+	}
+	if b.Total != 10000 {
+		t.Errorf("gold member paid %.2f, want the standard price 10000", b.Total)
+	}
+
+	basic := payStay(t, h, 2, standard, 10, 2)
+	if basic.Room != standard {
+		t.Errorf("basic member got room %d, want %d", basic.Room.ID, standard.ID)
+	}
+}
+
+func TestRedeemMorePointsThanNeeded(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	h.AddPoints(1, 8000)
+	b := selectStay(t, h, 1, room, 10, 1)
+	if err := h.RedeemPoints(b, 9000); err == nil {
+		t.Error("redeemed more points than the balance")
+	}
+	if err := h.RedeemPoints(b, 8000); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+
+	if b.Total != 0 || b.PointsRedeemed != 5000 || b.PointsEarned != 0 {
+		t.Errorf("total %.2f, redeemed %d, earned %d; want 0, 5000, 0", b.Total, b.PointsRedeemed, b.PointsEarned)
+	}
+	if got := h.Points(1); got != 3000 {
+		t.Errorf("balance = %d, want 3000", got)
+	}
+}
+
+func TestRedeemPointsBeforeDerivedAmounts(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	h.AddPoints(1, 1000)
+	b := selectStay(t, h, 1, room, 10, 2)
+	b.AgentID, b.Insured = 7, true
+	if err := h.RedeemPoints(b, 1000); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+
+	// Commission, insurance and earned points all follow the 9000 left.
+	if b.Commission != 720 || b.InsuranceFee != 450 || b.Total != 9450 || b.PointsEarned != 94 {
+		t.Errorf("commission %.2f, insurance %.2f, total %.2f, earned %d; want 720, 450, 9450, 94",
+			b.Commission, b.InsuranceFee, b.Total, b.PointsEarned)
+	}
+	if got := h.Points(1); got != 94 {
+		t.Errorf("balance = %d, want 94", got)
+	}
+}
+
+func TestPointsRoundingModes(t *testing.T) {
+	h, _ := newTestSystem()
+	for _, tt := range []struct {
+		rounding PointsRounding
+		want     int
+	}{
+		{PointsFloor, 12},
+		{PointsRound, 13},
+		{PointsCeil, 13},
+	} {
+		h.PointsRounding = tt.rounding
+		if got := h.pointsFor(1275); got != tt.want {
+			t.Errorf("%s accrual on 1275 = %d, want %d", tt.rounding, got, tt.want)
+		}
+	}
+
+	h.PointsRounding = PointsRound
+	h.PointsPerUnit = 0.05
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 4990})
+	if b := payStay(t, h, 1, room, 10, 1); b.PointsEarned != 250 || h.Points(1) != 250 {
+		t.Errorf("earned %d, balance %d; want 250 from 4990 at 5%% rounded", b.PointsEarned, h.Points(1))
+	}
+}
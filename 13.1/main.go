@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"time"
 )
 
@@ -13,6 +16,14 @@ const (
 	StateBookingConfirmed BookingState = "BookingConfirmed"
 	StatePaid             BookingState = "Paid"
 	StateBookingCancelled BookingState = "BookingCancelled"
+	StateQuoted           BookingState = "Quoted"
+	StateDisputed         BookingState = "Disputed"
+	StateRefunded         BookingState = "Refunded"
+	StateCheckedIn        BookingState = "CheckedIn"
+	StateNoShow           BookingState = "NoShow"
+	StateOffered          BookingState = "Offered"
+
+	StatePendingCancellation BookingState = "PendingCancellation"
 )
 
 type BookingEvent string
@@ -23,22 +34,176 @@ const (
 	EventPay            BookingEvent = "pay"
 	EventCancel         BookingEvent = "cancel"
 	EventChangeRoom     BookingEvent = "changeRoom"
+	EventQuote          BookingEvent = "quote"
+	EventAccept         BookingEvent = "accept"
+	EventDispute        BookingEvent = "dispute"
+	EventResolveDispute BookingEvent = "resolveDispute"
+	EventRefund         BookingEvent = "refund"
+	EventHotelRefund    BookingEvent = "hotelRefund"
+	EventCheckIn        BookingEvent = "checkIn"
+	EventNoShow         BookingEvent = "noShow"
+	EventTimeout        BookingEvent = "timeout"
+	EventOffer          BookingEvent = "offer"
+	EventAcceptOffer    BookingEvent = "acceptOffer"
+	EventCounter        BookingEvent = "counter"
+	EventRequestCancel  BookingEvent = "requestCancel"
+	EventApproveCancel  BookingEvent = "approveCancel"
+	EventDenyCancel     BookingEvent = "denyCancel"
+)
+
+const (
+	defaultQuoteTTL          = 30 * time.Minute
+	defaultFreeModifications = 2
+	defaultAbandonAfter      = 24 * time.Hour
+)
+
+var (
+	ErrTooManyTransitions   = errors.New("too many transitions")
+	ErrBlackoutDate         = errors.New("stay overlaps a blackout date")
+	ErrInsufficientLeadTime = errors.New("check-in is too soon")
+	ErrSystemPaused         = errors.New("booking system is paused")
+	ErrPromoNotFound        = errors.New("promo code not found")
+	ErrPromoExpired         = errors.New("promo code expired")
+	ErrPromoExhausted       = errors.New("promo code has no uses left")
+	ErrPromoRoomType        = errors.New("promo code does not apply to this room type")
+	ErrPromoMinSpend        = errors.New("booking is below the promo minimum spend")
+	ErrPromoFirstTimeOnly   = errors.New("promo code is for first-time guests only")
+	ErrPromoNotEligible     = errors.New("promo code is not available to this user")
 )
 
 type Room struct {
-	ID    int
-	Type  string
-	Price float64
+	ID         int
+	Type       string
+	Price      float64
+	HourlyRate float64
+	Capacity   int
+	Floor      int
+	View       string
+	Beds       BedType
+
+	UnderMaintenance bool
 }
 
+type BookingKind string
+
+const (
+	KindNightly BookingKind = "nightly"
+	KindHourly  BookingKind = "hourly"
+)
+
 type Booking struct {
 	ID        int
+	Reference string
 	UserID    int
+	AgentID   int
+	Kind      BookingKind
 	Room      *Room
+	Mode      AssignMode
 	State     BookingState
 	CreatedAt time.Time
 	PaidAt    time.Time
 	Total     float64
+
+	ConfirmedAt time.Time
+	CancelledAt time.Time
+	CheckedInAt time.Time
+	RoomRate    float64
+
+	CheckInDate  time.Time
+	CheckOutDate time.Time
+	Guests       int
+	GuestAges    []int
+	Contact      string
+
+	QuoteExpiresAt time.Time
+	QuotedPrice    float64
+	OfferPrice     float64
+
+	RequiresReconfirmation bool
+
+	LastTransitionAt time.Time
+
+	AddOns        []AddOn
+	AppliedPromo  string // comma-separated when codes were stacked
+	PromoDiscount float64
+
+	ModificationCount int
+	ModificationFees  float64
+
+	Commission    float64
+	GiftCard      *GiftCard
+	GiftCardPaid  float64
+	UpgradeCharge float64
+	BalanceDue    float64
+
+	OverstayNightsCharged int
+	Preferences           RoomPreferences
+
+	RateType            RateType
+	NonRefundable       bool
+	RateDiscountPercent float64
+
+	Insured      bool
+	InsuranceFee float64
+
+	PaymentCurrency string
+	ChargedAmount   float64
+	FXRate          float64
+
+	PointsEarned   int
+	PointsRedeemed int
+
+	DisputeOpenedAt time.Time
+	DisputeClosedAt time.Time
+	RefundedAmount  float64
+	Credits         []Credit
+
+	Metadata map[string]string
+}
+
+func (b *Booking) SetMeta(key, value string) {
+	if b.Metadata == nil {
+		b.Metadata = make(map[string]string)
+	}
+	b.Metadata[key] = value
+}
+
+func (b *Booking) GetMeta(key string) (string, bool) {
+	value, ok := b.Metadata[key]
+	return value, ok
+}
+
+// isPaid reports whether the booking has been paid and not refunded.
+func (b *Booking) isPaid() bool {
+	switch b.State {
+	case StatePaid, StateDisputed, StateCheckedIn, StatePendingCancellation:
+		return true
+	}
+	return false
+}
+
+// holdsRoom reports whether the booking currently occupies its room. Quotes
+// do not; they only keep a room through HoldForQuote.
+func (b *Booking) holdsRoom() bool {
+	switch b.State {
+	case StateIdle, StateQuoted, StateBookingCancelled, StateRefunded, StateNoShow:
+		return false
+	}
+	return b.Room != nil
+}
+
+// hasDates reports whether both stay dates are set.
+func (b *Booking) hasDates() bool {
+	return !b.CheckInDate.IsZero() && !b.CheckOutDate.IsZero()
+}
+
+// overlaps reports whether the stays of b and other intersect. The check-out
+// day of one stay may be the check-in day of the other.
+func (b *Booking) overlaps(other *Booking) bool {
+	if !b.hasDates() || !other.hasDates() {
+		return false
+	}
+	return b.CheckInDate.Before(other.CheckOutDate) && other.CheckInDate.Before(b.CheckOutDate)
 }
 
 type BookingHistory struct {
@@ -49,84 +214,637 @@ func (bh *BookingHistory) Add(b *Booking) {
 	bh.Bookings = append(bh.Bookings, b)
 }
 
-var discounts = map[string]float64{
-	"LOYALTY10": 10.0,
-	"HOLIDAY15": 15.0,
+func (bh *BookingHistory) find(id int) *Booking {
+	for _, b := range bh.Bookings {
+		if b.ID == id {
+			return b
+		}
+	}
+	return nil
+}
+
+// Merge appends the bookings of other that are not already present. It fails
+// without changing bh if a booking ID appears in both with different content.
+func (bh *BookingHistory) Merge(other *BookingHistory) error {
+	merged := &BookingHistory{}
+	for _, b := range other.Bookings {
+		existing := bh.find(b.ID)
+		if existing == nil {
+			existing = merged.find(b.ID)
+		}
+		if existing == nil {
+			merged.Add(b)
+			continue
+		}
+		if !sameBooking(existing, b) {
+			return fmt.Errorf("booking #%d differs between histories", b.ID)
+		}
+	}
+	bh.Bookings = append(bh.Bookings, merged.Bookings...)
+	return nil
+}
+
+func sameBooking(a, b *Booking) bool {
+	if (a.Room == nil) != (b.Room == nil) {
+		return false
+	}
+	if a.Room != nil && *a.Room != *b.Room {
+		return false
+	}
+	return a.ID == b.ID &&
+		a.UserID == b.UserID &&
+		a.State == b.State &&
+		a.Total == b.Total &&
+		a.CreatedAt.Equal(b.CreatedAt) &&
+		a.PaidAt.Equal(b.PaidAt) &&
+		a.CheckInDate.Equal(b.CheckInDate) &&
+		a.CheckOutDate.Equal(b.CheckOutDate)
 }
 
+type Guard func(booking *Booking, event BookingEvent) error
+
+type StateAction func(booking *Booking)
+
+type TransitionFunc func(booking *Booking, event BookingEvent, newRoom *Room, promoCode string) error
+
+type Middleware func(next TransitionFunc) TransitionFunc
+
 type HotelBookingSystem struct {
 	nextBookingID int
 	history       *BookingHistory
+	bookings      map[int]*Booking
+	references    map[string]int
+	rooms         map[int]*Room
+	promoCodes    map[string]*PromoCode
+	guards        []Guard
+	middleware    []Middleware
+	entryActions  map[BookingState]StateAction
+	notifier      Notifier
+	templates     map[BookingState]notificationTemplate
+	paused        bool
+	audit         []AuditEntry
+	blackoutDates map[time.Time]bool
+	userTiers     map[int]LoyaltyTier
+	userPoints    map[int]int
+	upgrades      []UpgradeRequest
+	timeouts      map[BookingState]StateTimeout
+
+	holdingEffects bool
+	heldEffects    []func()
+
+	Currency       string
+	Location       *time.Location
+	Clock          func() time.Time
+	QuoteTTL       time.Duration
+	HoldForQuote   bool
+	AbandonAfter   time.Duration
+	SurgeThreshold float64
+	SurgePercent   float64
+	WeekendDays    []time.Weekday
+	WeekendPercent float64
+
+	MinTransitionInterval time.Duration
+	MinLeadTime           time.Duration
+	CheckInTime           time.Duration
+	LateCheckInGrace      time.Duration
+	OverstayRate          float64
+	FreeModifications     int
+	ModificationFee       float64
+
+	AllowCancelWhilePaused bool
+
+	DefaultDiscountPercent float64
+	MaxDiscountPercent     float64
+	WeeklyDiscountNights   int
+	WeeklyDiscountPercent  float64
+
+	NonRefundableDiscountPercent float64
+	PriceDriftTolerancePercent   float64
+	AgentCommissionPercent       float64
+	PointValue                   float64
+	PointsPerUnit                float64
+	PointsRounding               PointsRounding
+	InsurancePercent             float64
+	CancelApprovalThreshold      float64
+	FXRate                       FXRateFunc
+
+	AgeBands AgeBands
 }
 
 func NewHotelBookingSystem() *HotelBookingSystem {
-	return &HotelBookingSystem{
+	h := &HotelBookingSystem{
 		nextBookingID: 1,
 		history:       &BookingHistory{},
+		bookings:      make(map[int]*Booking),
+		references:    make(map[string]int),
+		rooms:         make(map[int]*Room),
+		promoCodes:    make(map[string]*PromoCode),
+		blackoutDates: make(map[time.Time]bool),
+		userTiers:     make(map[int]LoyaltyTier),
+		userPoints:    make(map[int]int),
+		entryActions:  make(map[BookingState]StateAction),
+		templates:     make(map[BookingState]notificationTemplate),
+		timeouts:      make(map[BookingState]StateTimeout),
+
+		Currency:              "RUB",
+		Location:              time.Local,
+		Clock:                 time.Now,
+		QuoteTTL:              defaultQuoteTTL,
+		AbandonAfter:          defaultAbandonAfter,
+		CheckInTime:           defaultCheckInTime,
+		LateCheckInGrace:      defaultLateCheckInGrace,
+		FreeModifications:     defaultFreeModifications,
+		SurgeThreshold:        defaultSurgeThreshold,
+		SurgePercent:          defaultSurgePercent,
+		WeekendDays:           append([]time.Weekday(nil), defaultWeekendDays...),
+		WeeklyDiscountNights:  defaultWeeklyDiscountNights,
+		WeeklyDiscountPercent: defaultWeeklyDiscountPercent,
+
+		NonRefundableDiscountPercent: defaultNonRefundableDiscountPercent,
+		PriceDriftTolerancePercent:   defaultPriceDriftTolerancePercent,
+		AgentCommissionPercent:       defaultAgentCommissionPercent,
+		PointValue:                   defaultPointValue,
+		PointsPerUnit:                defaultPointsPerUnit,
+		PointsRounding:               PointsFloor,
+		InsurancePercent:             defaultInsurancePercent,
+
+		AgeBands: AgeBands{InfantMaxAge: 2, ChildMaxAge: 12},
+	}
+	for _, p := range defaultPromoCodes {
+		h.RegisterPromoCode(p)
+	}
+	for state, t := range defaultNotificationTemplates {
+		h.SetNotificationTemplate(state, t[0], t[1])
+	}
+	return h
+}
+
+func (h *HotelBookingSystem) AddRoom(r *Room) error {
+	if _, exists := h.rooms[r.ID]; exists {
+		return fmt.Errorf("room %d already exists", r.ID)
+	}
+	h.rooms[r.ID] = r
+	return nil
+}
+
+// sortedBookings returns all registered bookings ordered by ID.
+func (h *HotelBookingSystem) sortedBookings() []*Booking {
+	list := make([]*Booking, 0, len(h.bookings))
+	for _, b := range h.bookings {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// FindOverlaps returns pairs of bookings on the given room whose stay dates
+// intersect. Bookings that no longer hold the room, such as cancelled ones,
+// and bookings without dates are ignored.
+func (h *HotelBookingSystem) FindOverlaps(roomID int) [][2]*Booking {
+	var onRoom []*Booking
+	for _, b := range h.sortedBookings() {
+		if !b.holdsRoom() || b.Room.ID != roomID {
+			continue
+		}
+		onRoom = append(onRoom, b)
+	}
+
+	var pairs [][2]*Booking
+	for i := 0; i < len(onRoom); i++ {
+		for j := i + 1; j < len(onRoom); j++ {
+			if onRoom[i].overlaps(onRoom[j]) {
+				pairs = append(pairs, [2]*Booking{onRoom[i], onRoom[j]})
+			}
+		}
 	}
+	return pairs
+}
+
+// needsCancelApproval reports whether refunding the paid booking exceeds
+// CancelApprovalThreshold. A zero threshold never requires approval.
+func (h *HotelBookingSystem) needsCancelApproval(b *Booking) bool {
+	return h.CancelApprovalThreshold > 0 && b.Total > h.CancelApprovalThreshold
+}
+
+// FindByMeta returns the bookings whose metadata maps key to value, ordered
+// by booking ID.
+func (h *HotelBookingSystem) FindByMeta(key, value string) []*Booking {
+	var found []*Booking
+	for _, b := range h.sortedBookings() {
+		if v, ok := b.GetMeta(key); ok && v == value {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// FindDuplicates groups active bookings made by the same user for the same
+// room type over overlapping dates. Bookings are grouped transitively and
+// only groups of two or more are returned.
+func (h *HotelBookingSystem) FindDuplicates() [][]*Booking {
+	var groups [][]*Booking
+	for _, b := range h.sortedBookings() {
+		if !b.holdsRoom() {
+			continue
+		}
+		merged := []*Booking{b}
+		kept := groups[:0]
+		for _, g := range groups {
+			if isDuplicateOf(b, g) {
+				merged = append(g, merged...)
+			} else {
+				kept = append(kept, g)
+			}
+		}
+		groups = append(kept, merged)
+	}
+
+	var duplicates [][]*Booking
+	for _, g := range groups {
+		if len(g) > 1 {
+			sort.Slice(g, func(i, j int) bool { return g[i].ID < g[j].ID })
+			duplicates = append(duplicates, g)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i][0].ID < duplicates[j][0].ID })
+	return duplicates
+}
+
+func isDuplicateOf(b *Booking, group []*Booking) bool {
+	for _, other := range group {
+		if other.UserID == b.UserID && other.Room.Type == b.Room.Type && other.overlaps(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddGuard registers a check that runs before every transition. A non-nil
+// error from any guard aborts the transition.
+func (h *HotelBookingSystem) AddGuard(g Guard) {
+	h.guards = append(h.guards, g)
+}
+
+// OnEnterState sets the action run after a booking moves into state. It
+// replaces any action previously set for that state.
+func (h *HotelBookingSystem) OnEnterState(state BookingState, action StateAction) {
+	h.entryActions[state] = action
+}
+
+// Use wraps every transition in mw. The first middleware registered is the
+// outermost one.
+func (h *HotelBookingSystem) Use(mw ...Middleware) {
+	h.middleware = append(h.middleware, mw...)
+}
+
+var transitions = map[BookingState]map[BookingEvent]BookingState{
+	StateIdle: {
+		EventSelectRoom: StateRoomSelected,
+		EventQuote:      StateQuoted,
+	},
+	StateQuoted: {
+		EventAccept: StateRoomSelected,
+		EventCancel: StateBookingCancelled,
+	},
+	StateRoomSelected: {
+		EventConfirmBooking: StateBookingConfirmed,
+		EventChangeRoom:     StateRoomSelected,
+		EventOffer:          StateOffered,
+		EventCancel:         StateBookingCancelled,
+	},
+	StateOffered: {
+		EventCounter:     StateOffered,
+		EventAcceptOffer: StateRoomSelected,
+		EventCancel:      StateBookingCancelled,
+	},
+	StateBookingConfirmed: {
+		EventPay:    StatePaid,
+		EventCancel: StateBookingCancelled,
+	},
+	StatePaid: {
+		EventDispute: StateDisputed,
+		EventCheckIn: StateCheckedIn,
+		EventRefund:  StateRefunded,
+		EventNoShow:  StateNoShow,
+
+		EventHotelRefund:   StateRefunded,
+		EventRequestCancel: StatePendingCancellation,
+	},
+	StatePendingCancellation: {
+		EventApproveCancel: StateBookingCancelled,
+		EventDenyCancel:    StatePaid,
+	},
+	StateDisputed: {
+		EventResolveDispute: StatePaid,
+		EventRefund:         StateRefunded,
+		EventHotelRefund:    StateRefunded,
+	},
 }
 
 func (h *HotelBookingSystem) canTransition(from, to BookingState, event BookingEvent) bool {
-	transitions := map[BookingState]map[BookingEvent]BookingState{
-		StateIdle: {
-			EventSelectRoom: StateRoomSelected,
-		},
-		StateRoomSelected: {
-			EventConfirmBooking: StateBookingConfirmed,
-			EventChangeRoom:     StateRoomSelected,
-			EventCancel:         StateBookingCancelled,
-		},
-		StateBookingConfirmed: {
-			EventPay:    StatePaid,
-			EventCancel: StateBookingCancelled,
-		},
+	if event == EventTimeout {
+		timeout, ok := h.timeouts[from]
+		return ok && timeout.To == to && timeoutAllowed(from, to)
 	}
 	return transitions[from][event] == to
 }
 
 func (h *HotelBookingSystem) Transition(booking *Booking, event BookingEvent, newRoom *Room, promoCode string) error {
+	next := TransitionFunc(h.transition)
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		next = h.middleware[i](next)
+	}
+	return next(booking, event, newRoom, promoCode)
+}
+
+func (h *HotelBookingSystem) transition(booking *Booking, event BookingEvent, newRoom *Room, promoCode string) error {
 	var newState BookingState
 
+	if h.paused && !(event == EventCancel && h.AllowCancelWhilePaused) {
+		return ErrSystemPaused
+	}
+
+	for _, guard := range h.guards {
+		if err := guard(booking, event); err != nil {
+			return fmt.Errorf("transition %s rejected: %w", event, err)
+		}
+	}
+
+	if h.MinTransitionInterval > 0 && !booking.LastTransitionAt.IsZero() &&
+		h.now().Sub(booking.LastTransitionAt) < h.MinTransitionInterval {
+		return fmt.Errorf("booking #%d: %w", booking.ID, ErrTooManyTransitions)
+	}
+
 	switch event {
 	case EventSelectRoom:
 		if booking.State != StateIdle {
 			return fmt.Errorf("cannot select room from state %s", booking.State)
 		}
+		if err := h.checkQuoteHold(newRoom, booking); err != nil {
+			return err
+		}
+		if err := h.makeRoomFor(newRoom, booking); err != nil {
+			return err
+		}
 		booking.Room = newRoom
+		if upgrade := h.freeUpgrade(booking); upgrade != nil {
+			fmt.Printf("Booking #%d: complimentary upgrade to room %d (%s)\n", booking.ID, upgrade.ID, upgrade.Type)
+			booking.RoomRate = booking.rateOf(newRoom)
+			booking.Room = upgrade
+		}
+		newState = StateRoomSelected
+
+	case EventQuote:
+		if booking.State != StateIdle {
+			return fmt.Errorf("cannot quote from state %s", booking.State)
+		}
+		if err := h.checkQuoteHold(newRoom, booking); err != nil {
+			return err
+		}
+		booking.Room = newRoom
+		booking.QuoteExpiresAt = h.now().Add(h.QuoteTTL)
+		booking.QuotedPrice = h.PriceFor(booking)
+		newState = StateQuoted
+
+	case EventAccept:
+		if booking.State != StateQuoted {
+			return fmt.Errorf("accepting is only possible for a quoted booking")
+		}
+		if h.now().After(booking.QuoteExpiresAt) {
+			if err := h.Transition(booking, EventCancel, nil, ""); err != nil {
+				return err
+			}
+			return fmt.Errorf("quote for booking #%d has expired", booking.ID)
+		}
+		newState = StateRoomSelected
+
+	case EventOffer:
+		if booking.State != StateRoomSelected {
+			return fmt.Errorf("an offer can only be made for a selected room")
+		}
+		if booking.OfferPrice <= 0 {
+			return fmt.Errorf("offer price must be positive, got %.2f", booking.OfferPrice)
+		}
+		newState = StateOffered
+
+	case EventCounter:
+		if booking.State != StateOffered {
+			return fmt.Errorf("booking #%d has no open offer", booking.ID)
+		}
+		if booking.OfferPrice <= 0 {
+			return fmt.Errorf("counter price must be positive, got %.2f", booking.OfferPrice)
+		}
+		newState = StateOffered
+
+	case EventAcceptOffer:
+		if booking.State != StateOffered {
+			return fmt.Errorf("booking #%d has no open offer", booking.ID)
+		}
+		booking.RoomRate = booking.OfferPrice
 		newState = StateRoomSelected
 
 	case EventChangeRoom:
 		if booking.State != StateRoomSelected {
 			return fmt.Errorf("changing room is only available in RoomSelected state")
 		}
+		if err := h.checkQuoteHold(newRoom, booking); err != nil {
+			return err
+		}
+		if err := h.makeRoomFor(newRoom, booking); err != nil {
+			return err
+		}
 		booking.Room = newRoom
+		booking.RoomRate = 0
+		booking.ModificationCount++
+		if booking.ModificationCount > h.FreeModifications && h.ModificationFee > 0 {
+			booking.ModificationFees += h.ModificationFee
+			fmt.Printf("Booking #%d: modification fee %.0f charged\n", booking.ID, h.ModificationFee)
+		}
 		newState = StateRoomSelected
 
 	case EventConfirmBooking:
 		if booking.State != StateRoomSelected {
 			return fmt.Errorf("confirmation is only possible after selecting a room")
 		}
+		if err := h.checkBlackout(booking); err != nil {
+			return err
+		}
+		if h.MinLeadTime > 0 && booking.hasDates() && booking.CheckInDate.Before(h.now().Add(h.MinLeadTime)) {
+			return fmt.Errorf("booking #%d needs %s notice: %w", booking.ID, h.MinLeadTime, ErrInsufficientLeadTime)
+		}
+		booking.ConfirmedAt = h.now()
+		if booking.RoomRate == 0 {
+			booking.RoomRate = booking.rateOf(booking.Room)
+		}
 		newState = StateBookingConfirmed
 
 	case EventCancel:
 		if booking.State == StatePaid {
 			return fmt.Errorf("cannot cancel a paid booking")
 		}
+		if !h.canTransition(booking.State, StateBookingCancelled, event) {
+			return fmt.Errorf("cannot cancel a booking in state %s", booking.State)
+		}
+		booking.CancelledAt = h.now()
 		newState = StateBookingCancelled
 
 	case EventPay:
 		if booking.State != StateBookingConfirmed {
 			return fmt.Errorf("payment is only possible after confirmation")
 		}
-		total := booking.Room.Price
-		if discount, ok := discounts[promoCode]; ok {
-			total *= (1 - discount/100)
-			fmt.Printf("Promo code %s applied. Discount: %.0f%%\n", promoCode, discount)
+		// Everything that can fail comes first, and the booking, promo code
+		// and points balance are only updated once the payment is certain.
+		currency, rate, err := h.paymentRate(booking)
+		if err != nil {
+			return err
+		}
+		subtotal := h.subtotal(booking)
+		discounted, promos := h.applyDiscounts(booking, subtotal, promoCode)
+		total := RoundMoney(discounted, h.Currency)
+		promoDiscount := 0.0
+		if len(promos) > 0 {
+			promoDiscount = RoundMoney(h.discounted(subtotal, h.baseDiscountPercent(booking), 0), h.Currency) - total
+		}
+		points, pointsValue := h.pointsDiscount(booking, total)
+		total -= pointsValue
+		giftCardPaid := 0.0
+		if booking.GiftCard != nil {
+			giftCardPaid = math.Max(0, math.Min(booking.GiftCard.Balance, total))
+			total -= giftCardPaid
+		}
+		commission := 0.0
+		if booking.AgentID != 0 {
+			commission = RoundMoney(total*h.AgentCommissionPercent/100, h.Currency)
+		}
+		insuranceFee := 0.0
+		if booking.Insured {
+			insuranceFee = RoundMoney(total*h.InsurancePercent/100, h.Currency)
+			total += insuranceFee
+		}
+
+		codes := make([]string, len(promos))
+		for i, promo := range promos {
+			promo.Uses++
+			codes[i] = promo.Code
 		}
+		booking.AppliedPromo = JoinPromoCodes(codes)
 		booking.Total = total
-		booking.PaidAt = time.Now()
+		booking.PromoDiscount = promoDiscount
+		booking.PointsRedeemed = points
+		if booking.GiftCard != nil {
+			booking.GiftCard.Balance -= giftCardPaid
+		}
+		booking.GiftCardPaid = giftCardPaid
+		booking.Commission = commission
+		booking.InsuranceFee = insuranceFee
+		booking.PaymentCurrency, booking.FXRate = currency, rate
+		booking.ChargedAmount = RoundMoney(total*rate, currency)
+		booking.PointsEarned = h.pointsFor(total)
+		h.userPoints[booking.UserID] += booking.PointsEarned - points
+		if points > 0 {
+			fmt.Printf("Booking #%d: %d points redeemed, total: %s\n", booking.ID, points, FormatMoney(total, h.Currency))
+		}
+		if giftCardPaid > 0 {
+			fmt.Printf("Gift card %s redeemed: %s, total: %s\n", booking.GiftCard.Code,
+				FormatMoney(giftCardPaid, h.Currency), FormatMoney(total, h.Currency))
+		}
+		if currency != h.Currency {
+			fmt.Printf("Booking #%d: %s charged as %s\n", booking.ID,
+				FormatMoney(total, h.Currency), FormatMoney(booking.ChargedAmount, currency))
+		}
+		booking.PaidAt = h.now()
+		newState = StatePaid
+
+	case EventDispute:
+		if booking.State != StatePaid {
+			return fmt.Errorf("only a paid booking can be disputed")
+		}
+		booking.DisputeOpenedAt = h.now()
+		booking.DisputeClosedAt = time.Time{}
+		newState = StateDisputed
+
+	case EventResolveDispute:
+		if booking.State != StateDisputed {
+			return fmt.Errorf("booking #%d has no open dispute", booking.ID)
+		}
+		booking.DisputeClosedAt = h.now()
 		newState = StatePaid
 
+	case EventRefund, EventHotelRefund:
+		if booking.State != StateDisputed && booking.State != StatePaid {
+			return fmt.Errorf("refund is only possible for a paid or disputed booking")
+		}
+		// A refund the hotel initiates ignores the guest's non-refundable rate
+		// and the approval workflow.
+		if booking.NonRefundable && !booking.Insured && event != EventHotelRefund {
+			return fmt.Errorf("booking #%d has a non-refundable rate", booking.ID)
+		}
+		if booking.State == StatePaid && event != EventHotelRefund && h.needsCancelApproval(booking) {
+			return fmt.Errorf("refund of %s for booking #%d needs approval", FormatMoney(booking.Total, h.Currency), booking.ID)
+		}
+		if booking.State == StateDisputed {
+			booking.DisputeClosedAt = h.now()
+		}
+		booking.RefundedAmount = booking.Total
+		newState = StateRefunded
+
+	case EventRequestCancel:
+		if booking.State != StatePaid {
+			return fmt.Errorf("cancellation approval is only needed for a paid booking")
+		}
+		if booking.NonRefundable && !booking.Insured {
+			return fmt.Errorf("booking #%d has a non-refundable rate", booking.ID)
+		}
+		if !h.needsCancelApproval(booking) {
+			return fmt.Errorf("booking #%d can be refunded without approval", booking.ID)
+		}
+		newState = StatePendingCancellation
+
+	case EventApproveCancel:
+		if booking.State != StatePendingCancellation {
+			return fmt.Errorf("booking #%d has no pending cancellation", booking.ID)
+		}
+		booking.CancelledAt = h.now()
+		booking.RefundedAmount = booking.Total
+		newState = StateBookingCancelled
+
+	case EventDenyCancel:
+		if booking.State != StatePendingCancellation {
+			return fmt.Errorf("booking #%d has no pending cancellation", booking.ID)
+		}
+		newState = StatePaid
+
+	case EventCheckIn:
+		if booking.State != StatePaid {
+			return fmt.Errorf("check-in is only possible for a paid booking")
+		}
+		booking.CheckedInAt = h.now()
+		newState = StateCheckedIn
+
+	case EventNoShow:
+		if booking.State != StatePaid {
+			return fmt.Errorf("only a paid booking can be marked as a no-show")
+		}
+		newState = StateNoShow
+
+	case EventTimeout:
+		timeout, ok := h.timeouts[booking.State]
+		if !ok {
+			return fmt.Errorf("no timeout configured for state %s", booking.State)
+		}
+		switch timeout.To {
+		case StateRoomSelected:
+			// Unlock the rate taken from the room at confirmation; upgrade
+			// and negotiated rates stay.
+			if booking.State == StateBookingConfirmed && booking.RoomRate == booking.rateOf(booking.Room) {
+				booking.RoomRate = 0
+			}
+			booking.ConfirmedAt = time.Time{}
+		case StateBookingCancelled:
+			booking.CancelledAt = h.now()
+		}
+		newState = timeout.To
+
 	default:
 		return fmt.Errorf("unknown event: %s", event)
 	}
@@ -136,24 +854,153 @@ func (h *HotelBookingSystem) Transition(booking *Booking, event BookingEvent, ne
 	}
 
 	fmt.Printf("Booking #%d: %s -> %s\n", booking.ID, booking.State, newState)
+	oldState, now := booking.State, h.now()
+	h.audit = append(h.audit, AuditEntry{
+		BookingID: booking.ID,
+		Event:     event,
+		From:      oldState,
+		To:        newState,
+		At:        now,
+	})
 	booking.State = newState
+	booking.LastTransitionAt = now
 
-	if newState == StatePaid || newState == StateBookingCancelled {
+	if (newState == StatePaid || newState == StateBookingCancelled) && h.history.find(booking.ID) == nil {
 		h.history.Add(booking)
 	}
 
+	if newState == StateBookingCancelled && booking.Room != nil {
+		h.offerUpgrades(booking.Room)
+	}
+
+	if newState != oldState {
+		h.enterState(booking, newState)
+	}
+
+	return nil
+}
+
+// enterState runs the entry action and notification for state. While
+// ConfirmAndPay is in progress they are held until it succeeds, so a step it
+// rolls back announces nothing.
+func (h *HotelBookingSystem) enterState(b *Booking, state BookingState) {
+	effects := func() {
+		if action, ok := h.entryActions[state]; ok {
+			action(b)
+		}
+		h.notify(b, state)
+	}
+	if h.holdingEffects {
+		h.heldEffects = append(h.heldEffects, effects)
+		return
+	}
+	effects()
+}
+
+// ConfirmAndPay confirms and pays for the booking as a single step. If the
+// payment fails the confirmation is undone, without notifying the guest, and
+// the booking stays RoomSelected.
+func (h *HotelBookingSystem) ConfirmAndPay(booking *Booking, promoCode string) error {
+	h.holdingEffects = true
+	err := h.confirmAndPay(booking, promoCode)
+	effects := h.heldEffects
+	h.holdingEffects, h.heldEffects = false, nil
+	if err != nil {
+		return err
+	}
+	for _, effect := range effects {
+		effect()
+	}
+	return nil
+}
+
+func (h *HotelBookingSystem) confirmAndPay(booking *Booking, promoCode string) error {
+	// Fail before confirming, so no confirmation is announced for nothing.
+	if _, _, err := h.paymentRate(booking); err != nil {
+		return err
+	}
+	lastTransitionAt, roomRate, auditLen := booking.LastTransitionAt, booking.RoomRate, len(h.audit)
+	if err := h.Transition(booking, EventConfirmBooking, nil, promoCode); err != nil {
+		return err
+	}
+	// Both steps count as one transition for rate limiting.
+	booking.LastTransitionAt = lastTransitionAt
+	if err := h.Transition(booking, EventPay, nil, promoCode); err != nil {
+		booking.State = StateRoomSelected
+		booking.ConfirmedAt = time.Time{}
+		booking.RoomRate = roomRate
+		booking.LastTransitionAt = lastTransitionAt
+		h.audit = h.audit[:auditLen]
+		fmt.Printf("Booking #%d: payment failed, reverted to %s\n", booking.ID, booking.State)
+		return err
+	}
 	return nil
 }
 
-func (h *HotelBookingSystem) NewBooking(userID int) *Booking {
+// PurgeAbandoned removes bookings that have stayed in Idle for longer than
+// AbandonAfter from the registry and returns how many were removed.
+func (h *HotelBookingSystem) PurgeAbandoned(now time.Time) int {
+	purged := 0
+	for id, b := range h.bookings {
+		if b.State == StateIdle && now.Sub(b.CreatedAt) > h.AbandonAfter {
+			delete(h.bookings, id)
+			delete(h.references, b.Reference)
+			purged++
+		}
+	}
+	return purged
+}
+
+// ExpireQuotes cancels every quoted booking whose quote has expired by now
+// and returns how many were cancelled.
+func (h *HotelBookingSystem) ExpireQuotes(now time.Time) int {
+	expired := 0
+	for _, b := range h.sortedBookings() {
+		if b.State != StateQuoted || !now.After(b.QuoteExpiresAt) {
+			continue
+		}
+		if err := h.Transition(b, EventCancel, nil, ""); err == nil {
+			expired++
+		}
+	}
+	return expired
+}
+
+func (h *HotelBookingSystem) NewBooking(userID int) (*Booking, error) {
+	if h.paused {
+		return nil, ErrSystemPaused
+	}
 	b := &Booking{
 		ID:        h.nextBookingID,
+		Reference: h.newReference(),
 		UserID:    userID,
+		Kind:      KindNightly,
+		RateType:  RateRefundable,
 		State:     StateIdle,
-		CreatedAt: time.Now(),
+		CreatedAt: h.now(),
 	}
 	h.nextBookingID++
-	return b
+	h.bookings[b.ID] = b
+	h.references[b.Reference] = b.ID
+	return b, nil
+}
+
+// now returns the current time from Clock, which tests can replace.
+func (h *HotelBookingSystem) now() time.Time {
+	if h.Clock == nil {
+		return time.Now()
+	}
+	return h.Clock()
+}
+
+// Pause makes NewBooking and Transition fail with ErrSystemPaused until
+// Resume is called. Cancellations pass when AllowCancelWhilePaused is set.
+func (h *HotelBookingSystem) Pause() {
+	h.paused = true
+}
+
+func (h *HotelBookingSystem) Resume() {
+	h.paused = false
 }
 
 func main() {
@@ -161,32 +1008,43 @@ func main() {
 
 	standard := &Room{ID: 101, Type: "standard", Price: 5000}
 	deluxe := &Room{ID: 201, Type: "deluxe", Price: 10000}
+	system.AddRoom(standard)
+	system.AddRoom(deluxe)
 
 	fmt.Println("=== Scenario 1: Successful booking ===")
-	booking1 := system.NewBooking(1001)
+	booking1, _ := system.NewBooking(1001)
 	system.Transition(booking1, EventSelectRoom, standard, "")
 	system.Transition(booking1, EventConfirmBooking, nil, "")
 	system.Transition(booking1, EventPay, nil, "LOYALTY10")
 
 	fmt.Println("\n=== Scenario 2: Cancellation before payment ===")
-	booking2 := system.NewBooking(1002)
+	booking2, _ := system.NewBooking(1002)
 	system.Transition(booking2, EventSelectRoom, deluxe, "")
 	system.Transition(booking2, EventCancel, nil, "")
 
 	fmt.Println("\n=== Scenario 3: Change room ===")
-	booking3 := system.NewBooking(1003)
+	booking3, _ := system.NewBooking(1003)
 	system.Transition(booking3, EventSelectRoom, standard, "")
 	system.Transition(booking3, EventChangeRoom, deluxe, "")
 	system.Transition(booking3, EventConfirmBooking, nil, "")
 	system.Transition(booking3, EventPay, nil, "")
 
+	fmt.Println("\n=== Scenario 4: Quote ===")
+	booking4, _ := system.NewBooking(1004)
+	system.Transition(booking4, EventQuote, deluxe, "")
+	system.Transition(booking4, EventAccept, nil, "")
+	system.Transition(booking4, EventCancel, nil, "")
+
 	fmt.Println("\n=== Booking History ===")
 	for _, b := range system.history.Bookings {
 		status := "CANCELLED"
-		if b.State == StatePaid {
+		switch b.State {
+		case StatePaid:
 			status = "PAID"
+		case StateRefunded:
+			status = "REFUNDED"
 		}
-		fmt.Printf("ID: %d | Room: %d | Total: %.0f | Status: %s\n",
-			b.ID, b.Room.ID, b.Total, status)
+		fmt.Printf("ID: %d | Room: %d | Total: %s | Status: %s\n",
+			b.ID, b.Room.ID, FormatMoney(b.Total, system.Currency), status)
 	}
 }
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestSystem returns a system in UTC whose clock only moves when the
+// returned testClock is advanced.
+func newTestSystem() (*HotelBookingSystem, *testClock) {
+	h := NewHotelBookingSystem()
+	clock := &testClock{now: testNow}
+	h.Clock = clock.Now
+	h.Location = time.UTC
+	return h, clock
+}
+
+// day returns midnight UTC n days after testNow.
+func day(n int) time.Time {
+	return dayOf(testNow).AddDate(0, 0, n)
+}
+
+func addRoom(t *testing.T, h *HotelBookingSystem, r *Room) *Room {
+	t.Helper()
+	if err := h.AddRoom(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func mustTransition(t *testing.T, h *HotelBookingSystem, b *Booking, event BookingEvent, room *Room, promoCode string) {
+	t.Helper()
+	if err := h.Transition(b, event, room, promoCode); err != nil {
+		t.Fatalf("booking #%d %s: %v", b.ID, event, err)
+	}
+}
+
+// selectStay creates a booking for userID on room for the given nights
+// starting from day(from), and selects the room.
+func selectStay(t *testing.T, h *HotelBookingSystem, userID int, room *Room, from, nights int) *Booking {
+	t.Helper()
+	b, err := h.NewBooking(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.CheckInDate, b.CheckOutDate = day(from), day(from+nights)
+	mustTransition(t, h, b, EventSelectRoom, room, "")
+	return b
+}
+
+// payStay books and pays for a stay in one go.
+func payStay(t *testing.T, h *HotelBookingSystem, userID int, room *Room, from, nights int) *Booking {
+	t.Helper()
+	b := selectStay(t, h, userID, room, from, nights)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	return b
+}
+
+func TestFindOverlapsReportsOverlappingPair(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	// Imported data can put two bookings on one room without any check.
+	first := selectStay(t, h, 1, room, 10, 3)
+	second, _ := h.NewBooking(2)
+	second.CheckInDate, second.CheckOutDate = day(12), day(14)
+	second.Room, second.State = room, StateRoomSelected
+	selectStay(t, h, 3, room, 13, 2).State = StateBookingCancelled
+
+	pairs := h.FindOverlaps(room.ID)
+	if len(pairs) != 1 {
+		t.Fatalf("FindOverlaps = %d pairs, want 1", len(pairs))
+	}
+	if pairs[0][0] != first || pairs[0][1] != second {
+		t.Errorf("FindOverlaps pair = #%d/#%d, want #%d/#%d", pairs[0][0].ID, pairs[0][1].ID, first.ID, second.ID)
+	}
+}
+
+func TestFindOverlapsAllowsBackToBackStays(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	selectStay(t, h, 1, room, 10, 3)
+	selectStay(t, h, 2, room, 13, 2)
+
+	if pairs := h.FindOverlaps(room.ID); len(pairs) != 0 {
+		t.Errorf("FindOverlaps = %d pairs, want none", len(pairs))
+	}
+}
+
+func TestQuoteConvertsBeforeExpiry(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	b, _ := h.NewBooking(1)
+	mustTransition(t, h, b, EventQuote, room, "")
+	if b.QuotedPrice != 10000 {
+		t.Errorf("QuotedPrice = %.2f, want 10000", b.QuotedPrice)
+	}
+
+	clock.Advance(h.QuoteTTL - time.Minute)
+	mustTransition(t, h, b, EventAccept, nil, "")
+	if b.State != StateRoomSelected {
+		t.Errorf("state = %s, want %s", b.State, StateRoomSelected)
+	}
+}
+
+func TestQuoteExpires(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	late, _ := h.NewBooking(1)
+	mustTransition(t, h, late, EventQuote, room, "")
+	swept, _ := h.NewBooking(2)
+	mustTransition(t, h, swept, EventQuote, room, "")
+
+	clock.Advance(h.QuoteTTL + time.Minute)
+	if err := h.Transition(late, EventAccept, nil, ""); err == nil {
+		t.Fatal("accepting an expired quote succeeded")
+	}
+	if late.State != StateBookingCancelled {
+		t.Errorf("expired quote state = %s, want %s", late.State, StateBookingCancelled)
+	}
+	if n := h.ExpireQuotes(clock.Now()); n != 1 {
+		t.Errorf("ExpireQuotes = %d, want 1", n)
+	}
+	if swept.State != StateBookingCancelled {
+		t.Errorf("swept quote state = %s, want %s", swept.State, StateBookingCancelled)
+	}
+}
+
+func TestGuardBlocksPayment(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	blocked := errors.New("user is blocklisted")
+	h.AddGuard(func(b *Booking, event BookingEvent) error {
+		if event == EventPay && b.UserID == 13 {
+			return blocked
+		}
+		return nil
+	})
+
+	b := selectStay(t, h, 13, room, 10, 1)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	if err := h.Transition(b, EventPay, nil, ""); !errors.Is(err, blocked) {
+		t.Fatalf("pay error = %v, want %v", err, blocked)
+	}
+	if b.State != StateBookingConfirmed || !b.PaidAt.IsZero() {
+		t.Errorf("blocked payment left state %s, PaidAt %v", b.State, b.PaidAt)
+	}
+
+	payStay(t, h, 14, room, 20, 1)
+}
+
+func TestMergeHistories(t *testing.T) {
+	paid := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	shared := &Booking{ID: 1, UserID: 10, State: StatePaid, Total: 5000, PaidAt: paid}
+	branchA := &BookingHistory{}
+	branchA.Add(shared)
+	branchA.Add(&Booking{ID: 2, UserID: 11, State: StatePaid, Total: 7000, PaidAt: paid})
+
+	branchB := &BookingHistory{}
+	copyOfShared := *shared
+	branchB.Add(&copyOfShared)
+	branchB.Add(&Booking{ID: 3, UserID: 12, State: StateBookingCancelled})
+
+	if err := branchA.Merge(branchB); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, b := range branchA.Bookings {
+		ids = append(ids, b.ID)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Errorf("merged IDs = %v, want [1 2 3]", ids)
+	}
+}
+
+func TestMergeRejectsConflictingBooking(t *testing.T) {
+	branchA := &BookingHistory{}
+	branchA.Add(&Booking{ID: 1, UserID: 10, Total: 5000})
+	branchB := &BookingHistory{}
+	branchB.Add(&Booking{ID: 4, UserID: 12})
+	branchB.Add(&Booking{ID: 1, UserID: 10, Total: 6000})
+
+	if err := branchA.Merge(branchB); err == nil {
+		t.Fatal("merging a conflicting booking succeeded")
+	}
+	if len(branchA.Bookings) != 1 {
+		t.Errorf("failed merge left %d bookings, want 1", len(branchA.Bookings))
+	}
+}
+
+func TestMinTransitionInterval(t *testing.T) {
+	h, clock := newTestSystem()
+	h.MinTransitionInterval = time.Minute
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+
+	clock.Advance(10 * time.Second)
+	if err := h.Transition(b, EventConfirmBooking, nil, ""); !errors.Is(err, ErrTooManyTransitions) {
+		t.Fatalf("quick transition error = %v, want %v", err, ErrTooManyTransitions)
+	}
+	clock.Advance(time.Minute)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+}
+
+func TestConfirmAndPay(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	if err := h.ConfirmAndPay(b, ""); err != nil {
+		t.Fatal(err)
+	}
+	if b.State != StatePaid || b.Total != 5000 {
+		t.Errorf("state %s, total %.2f; want %s, 5000", b.State, b.Total, StatePaid)
+	}
+}
+
+func TestConfirmAndPayRevertsWhenPaymentFails(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	declined := errors.New("card declined")
+	h.AddGuard(func(b *Booking, event BookingEvent) error {
+		if event == EventPay {
+			return declined
+		}
+		return nil
+	})
+	b := selectStay(t, h, 1, room, 10, 1)
+	auditLen := len(h.audit)
+
+	if err := h.ConfirmAndPay(b, ""); !errors.Is(err, declined) {
+		t.Fatalf("ConfirmAndPay error = %v, want %v", err, declined)
+	}
+	if b.State != StateRoomSelected || !b.ConfirmedAt.IsZero() || b.RoomRate != 0 {
+		t.Errorf("state %s, ConfirmedAt %v, RoomRate %.2f; want RoomSelected with nothing locked",
+			b.State, b.ConfirmedAt, b.RoomRate)
+	}
+	if len(h.audit) != auditLen {
+		t.Errorf("audit has %d entries, want %d", len(h.audit), auditLen)
+	}
+}
+
+func TestDisputeOpenAndResolve(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 10, 1)
+
+	clock.Advance(time.Hour)
+	mustTransition(t, h, b, EventDispute, nil, "")
+	if !b.DisputeOpenedAt.Equal(clock.Now()) {
+		t.Errorf("DisputeOpenedAt = %v, want %v", b.DisputeOpenedAt, clock.Now())
+	}
+	if err := h.Transition(b, EventCheckIn, nil, ""); err == nil {
+		t.Error("checked in a disputed booking")
+	}
+
+	clock.Advance(24 * time.Hour)
+	mustTransition(t, h, b, EventResolveDispute, nil, "")
+	if b.State != StatePaid || !b.DisputeClosedAt.Equal(clock.Now()) {
+		t.Errorf("state %s, DisputeClosedAt %v; want Paid, %v", b.State, b.DisputeClosedAt, clock.Now())
+	}
+}
+
+func TestDisputeEndsInRefund(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 10, 1)
+	mustTransition(t, h, b, EventDispute, nil, "")
+	mustTransition(t, h, b, EventRefund, nil, "")
+	if b.State != StateRefunded || b.RefundedAmount != 5000 || b.DisputeClosedAt.IsZero() {
+		t.Errorf("state %s, refunded %.2f, closed %v; want a closed, refunded dispute",
+			b.State, b.RefundedAmount, b.DisputeClosedAt)
+	}
+}
+
+func TestEntryActionRunsOnce(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	runs := 0
+	h.OnEnterState(StatePaid, func(b *Booking) { runs++ })
+
+	b := payStay(t, h, 1, room, 10, 1)
+	if runs != 1 {
+		t.Fatalf("action ran %d times after payment, want 1", runs)
+	}
+	mustTransition(t, h, b, EventDispute, nil, "")
+	mustTransition(t, h, b, EventResolveDispute, nil, "")
+	if runs != 2 {
+		t.Errorf("action ran %d times after re-entering Paid, want 2", runs)
+	}
+}
+
+func TestMinLeadTimeRejectsSameDay(t *testing.T) {
+	h, _ := newTestSystem()
+	h.MinLeadTime = 24 * time.Hour
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	sameDay := selectStay(t, h, 1, room, 0, 1)
+	sameDay.CheckInDate = testNow.Add(5 * time.Hour)
+	if err := h.Transition(sameDay, EventConfirmBooking, nil, ""); !errors.Is(err, ErrInsufficientLeadTime) {
+		t.Fatalf("same-day confirm error = %v, want %v", err, ErrInsufficientLeadTime)
+	}
+	mustTransition(t, h, selectStay(t, h, 2, room, 2, 1), EventConfirmBooking, nil, "")
+
+	h.MinLeadTime = 0
+	mustTransition(t, h, sameDay, EventConfirmBooking, nil, "")
+}
+
+func TestPauseAndResume(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+
+	h.Pause()
+	if _, err := h.NewBooking(2); !errors.Is(err, ErrSystemPaused) {
+		t.Errorf("NewBooking while paused error = %v, want %v", err, ErrSystemPaused)
+	}
+	if err := h.Transition(b, EventConfirmBooking, nil, ""); !errors.Is(err, ErrSystemPaused) {
+		t.Errorf("confirm while paused error = %v, want %v", err, ErrSystemPaused)
+	}
+	if err := h.Transition(b, EventCancel, nil, ""); !errors.Is(err, ErrSystemPaused) {
+		t.Errorf("cancel while paused error = %v, want %v", err, ErrSystemPaused)
+	}
+
+	h.Resume()
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	if _, err := h.NewBooking(2); err != nil {
+		t.Errorf("NewBooking after resume: %v", err)
+	}
+}
+
+func TestCancelAllowedWhilePaused(t *testing.T) {
+	h, _ := newTestSystem()
+	h.AllowCancelWhilePaused = true
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	h.Pause()
+	mustTransition(t, h, b, EventCancel, nil, "")
+}
+
+func TestModificationFeeAfterFreeChanges(t *testing.T) {
+	h, _ := newTestSystem()
+	h.ModificationFee = 700
+	a := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	booking := selectStay(t, h, 1, a, 10, 1)
+
+	// The first two changes are free.
+	for i, want := range []float64{0, 0, 700} {
+		room := b
+		if i%2 == 1 {
+			room = a
+		}
+		mustTransition(t, h, booking, EventChangeRoom, room, "")
+		if booking.ModificationFees != want {
+			t.Errorf("after change %d fees = %.2f, want %.2f", i+1, booking.ModificationFees, want)
+		}
+	}
+	mustTransition(t, h, booking, EventConfirmBooking, nil, "")
+	mustTransition(t, h, booking, EventPay, nil, "")
+	if booking.ModificationCount != 3 || booking.Total != 5700 {
+		t.Errorf("count %d, total %.2f; want 3 changes and 5700", booking.ModificationCount, booking.Total)
+	}
+}
+
+func TestPurgeAbandonedIdleBookings(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	stale, _ := h.NewBooking(1)
+	progressed := selectStay(t, h, 2, room, 10, 1)
+	clock.Advance(20 * time.Hour)
+	recent, _ := h.NewBooking(3)
+
+	if n := h.PurgeAbandoned(testNow.Add(h.AbandonAfter + time.Minute)); n != 1 {
+		t.Fatalf("PurgeAbandoned = %d, want 1", n)
+	}
+	if _, ok := h.bookings[stale.ID]; ok {
+		t.Error("stale Idle booking still registered")
+	}
+	if _, err := h.GetByReference(stale.Reference); err == nil {
+		t.Error("stale booking still found by reference")
+	}
+	if h.bookings[progressed.ID] == nil || h.bookings[recent.ID] == nil {
+		t.Error("bookings that are not stale Idle ones were purged")
+	}
+}
+
+func TestOfferCounterAndAccept(t *testing.T) {
+	h, _ := newTestSystem()
+	suite := addRoom(t, h, &Room{ID: 301, Type: "suite", Price: 20000})
+	b := selectStay(t, h, 1, suite, 10, 3)
+
+	if err := h.MakeOffer(b, 0); err == nil {
+		t.Error("offer without a price accepted")
+	}
+	if err := h.MakeOffer(b, 15000); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Counter(b, -1); err == nil || b.OfferPrice != 15000 {
+		t.Errorf("negative counter accepted or lost the offer of 15000, now %.2f", b.OfferPrice)
+	}
+	if err := h.Counter(b, 17500); err != nil {
+		t.Fatal(err)
+	}
+	if b.State != StateOffered {
+		t.Fatalf("state after counter = %s, want %s", b.State, StateOffered)
+	}
+	mustTransition(t, h, b, EventAcceptOffer, nil, "")
+	if b.State != StateRoomSelected || b.RoomRate != 17500 {
+		t.Errorf("state %s, rate %.2f; want RoomSelected at the countered 17500", b.State, b.RoomRate)
+	}
+
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	if b.Total != 3*17500 {
+		t.Errorf("Total = %.2f, want %.2f for 3 nights at the negotiated rate", b.Total, 3*17500.0)
+	}
+}
+
+func TestCountingMiddleware(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	counts := make(map[BookingEvent]int)
+	var order []string
+	h.Use(func(next TransitionFunc) TransitionFunc {
+		return func(b *Booking, event BookingEvent, newRoom *Room, promoCode string) error {
+			counts[event]++
+			order = append(order, "outer")
+			return next(b, event, newRoom, promoCode)
+		}
+	}, func(next TransitionFunc) TransitionFunc {
+		return func(b *Booking, event BookingEvent, newRoom *Room, promoCode string) error {
+			order = append(order, "inner")
+			return next(b, event, newRoom, promoCode)
+		}
+	})
+
+	b := payStay(t, h, 1, room, 10, 1)
+	if err := h.Transition(b, EventCancel, nil, ""); err == nil {
+		t.Fatal("cancelled a paid booking")
+	}
+	if counts[EventSelectRoom] != 1 || counts[EventConfirmBooking] != 1 || counts[EventPay] != 1 || counts[EventCancel] != 1 {
+		t.Errorf("counts = %v, want one of each event", counts)
+	}
+	if len(order) != 8 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("call order = %v, want outer before inner on every transition", order)
+	}
+}
+
+func TestFindDuplicatesGroupsSameGuest(t *testing.T) {
+	h, _ := newTestSystem()
+	a := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	deluxe := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	first := payStay(t, h, 1, a, 10, 3)
+	double := selectStay(t, h, 1, b, 11, 2)
+	selectStay(t, h, 1, deluxe, 10, 3)
+	selectStay(t, h, 2, a, 20, 2)
+	later := selectStay(t, h, 1, b, 13, 1)
+	mustTransition(t, h, later, EventCancel, nil, "")
+
+	groups := h.FindDuplicates()
+	if len(groups) != 1 || len(groups[0]) != 2 || groups[0][0] != first || groups[0][1] != double {
+		t.Fatalf("FindDuplicates = %v, want one group of #%d and #%d", groups, first.ID, double.ID)
+	}
+}
+
+func TestMetadataRoundTripsThroughJSON(t *testing.T) {
+	h, _ := newTestSystem()
+	b, _ := h.NewBooking(1)
+	if _, ok := b.GetMeta("channel"); ok {
+		t.Error("new booking has metadata")
+	}
+	b.SetMeta("channel", "partner")
+	b.SetMeta("externalId", "PX-42")
+	b.SetMeta("channel", "web")
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Booking
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"channel": "web", "externalId": "PX-42"} {
+		if got, ok := decoded.GetMeta(key); !ok || got != want {
+			t.Errorf("decoded %s = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+}
+
+func TestSplitBookingCopiesMetadata(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 10, 4)
+	b.SetMeta("campaign", "spring")
+
+	_, second, err := h.SplitBooking(b, day(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.SetMeta("campaign", "moved")
+	second.SetMeta("note", "new room")
+	if v, _ := b.GetMeta("campaign"); v != "spring" || len(b.Metadata) != 1 {
+		t.Errorf("first half metadata = %v after changing the second", b.Metadata)
+	}
+}
+
+func TestFindByMeta(t *testing.T) {
+	h, _ := newTestSystem()
+	var web []*Booking
+	for user, channel := range []string{"web", "phone", "web", "", "web"} {
+		b, _ := h.NewBooking(user + 1)
+		if channel != "" {
+			b.SetMeta("channel", channel)
+		}
+		if channel == "web" {
+			web = append(web, b)
+		}
+	}
+
+	got := h.FindByMeta("channel", "web")
+	if len(got) != len(web) {
+		t.Fatalf("FindByMeta(channel, web) = %d bookings, want %d", len(got), len(web))
+	}
+	for i := range web {
+		if got[i] != web[i] {
+			t.Errorf("match %d = #%d, want #%d", i, got[i].ID, web[i].ID)
+		}
+	}
+	if got := h.FindByMeta("channel", "email"); len(got) != 0 {
+		t.Errorf("FindByMeta(channel, email) = %d bookings, want none", len(got))
+	}
+}
+
+func TestHighValueRefundNeedsApproval(t *testing.T) {
+	h, _ := newTestSystem()
+	h.CancelApprovalThreshold = 10000
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	small := payStay(t, h, 1, room, 1, 1)
+	if err := h.Transition(small, EventRefund, nil, ""); err != nil {
+		t.Fatalf("refund below the threshold: %v", err)
+	}
+
+	approved := payStay(t, h, 2, room, 3, 3)
+	if err := h.Transition(approved, EventRefund, nil, ""); err == nil {
+		t.Fatal("refund above the threshold succeeded without approval")
+	}
+	mustTransition(t, h, approved, EventRequestCancel, nil, "")
+	if approved.State != StatePendingCancellation {
+		t.Fatalf("state = %s, want %s", approved.State, StatePendingCancellation)
+	}
+	mustTransition(t, h, approved, EventApproveCancel, nil, "")
+	if approved.State != StateBookingCancelled || approved.RefundedAmount != approved.Total {
+		t.Errorf("approved: state %s, refunded %.0f of %.0f", approved.State, approved.RefundedAmount, approved.Total)
+	}
+
+	denied := payStay(t, h, 3, room, 10, 3)
+	mustTransition(t, h, denied, EventRequestCancel, nil, "")
+	mustTransition(t, h, denied, EventDenyCancel, nil, "")
+	if denied.State != StatePaid || denied.RefundedAmount != 0 {
+		t.Errorf("denied: state %s, refunded %.0f", denied.State, denied.RefundedAmount)
+	}
+
+	// The hotel closing the room refunds without waiting for approval.
+	if affected := h.CloseRoom(room.ID, "flood"); len(affected) != 1 || affected[0] != denied {
+		t.Fatalf("CloseRoom affected %d bookings, want only #%d", len(affected), denied.ID)
+	}
+	if denied.State != StateRefunded || denied.RefundedAmount != denied.Total {
+		t.Errorf("after closing: state %s, refunded %.0f of %.0f", denied.State, denied.RefundedAmount, denied.Total)
+	}
+}
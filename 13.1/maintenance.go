@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// MaintenanceReport counts the bookings affected by each sweep of
+// RunMaintenance.
+type MaintenanceReport struct {
+	ExpiredQuotes int
+	NoShows       int
+	Overstays     int
+	TimedOut      int
+}
+
+// RunMaintenance runs every periodic sweep as of now. Quotes are expired
+// before timeouts are applied so a quote is never handled twice.
+func (h *HotelBookingSystem) RunMaintenance(now time.Time) MaintenanceReport {
+	return MaintenanceReport{
+		ExpiredQuotes: h.ExpireQuotes(now),
+		NoShows:       h.ProcessNoShows(now),
+		Overstays:     h.ChargeOverstays(now),
+		TimedOut:      h.ProcessTimeouts(now),
+	}
+}
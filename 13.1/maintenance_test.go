@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunMaintenanceReport(t *testing.T) {
+	h, _ := newTestSystem()
+	if err := h.SetStateTimeout(StateQuoted, 10*time.Minute, StateBookingCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetStateTimeout(StateBookingConfirmed, time.Hour, StateRoomSelected); err != nil {
+		t.Fatal(err)
+	}
+	a := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+
+	quote, _ := h.NewBooking(1)
+	mustTransition(t, h, quote, EventQuote, a, "")
+	missed := payStay(t, h, 2, a, 3, 1)
+	staying := payStay(t, h, 3, b, 1, 2)
+	mustTransition(t, h, staying, EventCheckIn, nil, "")
+	unpaid := selectStay(t, h, 4, b, 20, 1)
+	mustTransition(t, h, unpaid, EventConfirmBooking, nil, "")
+	payStay(t, h, 5, a, 20, 1)
+
+	got := h.RunMaintenance(day(5).Add(10 * time.Hour))
+	want := MaintenanceReport{ExpiredQuotes: 1, NoShows: 1, Overstays: 1, TimedOut: 1}
+	if got != want {
+		t.Errorf("RunMaintenance = %+v, want %+v", got, want)
+	}
+	if quote.State != StateBookingCancelled || missed.State != StateNoShow ||
+		staying.BalanceDue != 10000 || unpaid.State != StateRoomSelected {
+		t.Errorf("states %s, %s, balance %.2f, %s; want each booking handled once",
+			quote.State, missed.State, staying.BalanceDue, unpaid.State)
+	}
+}
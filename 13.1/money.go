@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const defaultMinorUnits = 2
+
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+var currencies = map[string]Currency{
+	"RUB": {Code: "RUB", MinorUnits: 2},
+	"USD": {Code: "USD", MinorUnits: 2},
+	"EUR": {Code: "EUR", MinorUnits: 2},
+	"JPY": {Code: "JPY", MinorUnits: 0},
+}
+
+func RegisterCurrency(c Currency) error {
+	if c.Code == "" {
+		return fmt.Errorf("currency code must not be empty")
+	}
+	if c.MinorUnits < 0 {
+		return fmt.Errorf("currency %s: minor units must not be negative", c.Code)
+	}
+	currencies[c.Code] = c
+	return nil
+}
+
+func minorUnits(code string) int {
+	if c, ok := currencies[code]; ok {
+		return c.MinorUnits
+	}
+	return defaultMinorUnits
+}
+
+// RoundMoney rounds amount to the minor unit of the given currency.
+func RoundMoney(amount float64, code string) float64 {
+	scale := math.Pow10(minorUnits(code))
+	return math.Round(amount*scale) / scale
+}
+
+func FormatMoney(amount float64, code string) string {
+	return fmt.Sprintf("%.*f %s", minorUnits(code), RoundMoney(amount, code), code)
+}
+
+// FXRateFunc returns how many units of to one unit of from buys.
+type FXRateFunc func(from, to string) (float64, error)
+
+// paymentRate returns the currency the booking is paid in and how many units
+// of it one unit of the hotel's currency buys at the current FXRate.
+func (h *HotelBookingSystem) paymentRate(b *Booking) (string, float64, error) {
+	if b.PaymentCurrency == "" || b.PaymentCurrency == h.Currency {
+		return h.Currency, 1, nil
+	}
+	if h.FXRate == nil {
+		return "", 0, fmt.Errorf("no exchange rate source to convert %s to %s", h.Currency, b.PaymentCurrency)
+	}
+	rate, err := h.FXRate(h.Currency, b.PaymentCurrency)
+	if err != nil {
+		return "", 0, fmt.Errorf("exchange rate %s to %s: %w", h.Currency, b.PaymentCurrency, err)
+	}
+	if rate <= 0 {
+		return "", 0, fmt.Errorf("exchange rate %s to %s must be positive, got %f", h.Currency, b.PaymentCurrency, rate)
+	}
+	return b.PaymentCurrency, rate, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFormatMoneyUsesMinorUnits(t *testing.T) {
+	for _, tt := range []struct {
+		amount float64
+		code   string
+		want   string
+	}{
+		{1234.5, "JPY", "1235 JPY"},
+		{1234.5, "USD", "1234.50 USD"},
+		{0.125, "USD", "0.13 USD"},
+		{1234.5, "XXX", "1234.50 XXX"},
+	} {
+		if got := FormatMoney(tt.amount, tt.code); got != tt.want {
+			t.Errorf("FormatMoney(%v, %s) = %q, want %q", tt.amount, tt.code, got, tt.want)
+		}
+	}
+	if got := RoundMoney(99.6, "JPY"); got != 100 {
+		t.Errorf("RoundMoney(99.6, JPY) = %v, want 100", got)
+	}
+}
+
+func TestRegisterCurrency(t *testing.T) {
+	if err := RegisterCurrency(Currency{Code: "KWD", MinorUnits: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatMoney(1.23456, "KWD"); got != "1.235 KWD" {
+		t.Errorf("FormatMoney in KWD = %q, want %q", got, "1.235 KWD")
+	}
+	if err := RegisterCurrency(Currency{Code: "BAD", MinorUnits: -1}); err == nil {
+		t.Error("negative minor units accepted")
+	}
+}
+
+func TestPayInUSDRecordsBothAmounts(t *testing.T) {
+	h, _ := newTestSystem()
+	h.FXRate = func(from, to string) (float64, error) {
+		if from == "RUB" && to == "USD" {
+			return 0.011, nil
+		}
+		return 0, fmt.Errorf("no rate for %s/%s", from, to)
+	}
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 2)
+	b.PaymentCurrency = "USD"
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+
+	if b.Total != 10000 || b.ChargedAmount != 110 || b.FXRate != 0.011 {
+		t.Errorf("total %.2f RUB, charged %.2f USD at %v; want 10000, 110 at 0.011", b.Total, b.ChargedAmount, b.FXRate)
+	}
+}
+
+func TestFailedFXLookupChangesNothing(t *testing.T) {
+	h, _ := newTestSystem()
+	h.FXRate = func(from, to string) (float64, error) { return 0, errors.New("rates unavailable") }
+	h.AgentCommissionPercent = 10
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	h.AddPoints(1, 100)
+	b := selectStay(t, h, 1, room, 10, 2)
+	b.PaymentCurrency, b.AgentID, b.Insured = "USD", 7, true
+	if err := h.RedeemPoints(b, 100); err != nil {
+		t.Fatal(err)
+	}
+	confirmed := 0
+	h.OnEnterState(StateBookingConfirmed, func(*Booking) { confirmed++ })
+
+	if err := h.ConfirmAndPay(b, "LOYALTY10"); err == nil {
+		t.Fatal("ConfirmAndPay succeeded without an exchange rate")
+	}
+	if confirmed != 0 || b.State != StateRoomSelected {
+		t.Errorf("confirmation ran %d times, state %s; want no confirmation", confirmed, b.State)
+	}
+
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	if err := h.Transition(b, EventPay, nil, "LOYALTY10"); err == nil {
+		t.Fatal("payment succeeded without an exchange rate")
+	}
+	if b.Total != 0 || b.AppliedPromo != "" || b.PromoDiscount != 0 || b.Commission != 0 ||
+		b.InsuranceFee != 0 || b.ChargedAmount != 0 || b.PointsEarned != 0 {
+		t.Errorf("failed payment left amounts on the booking: %+v", *b)
+	}
+	if h.promoCodes["LOYALTY10"].Uses != 0 || h.Points(1) != 100 {
+		t.Errorf("failed payment used the promo code (%d uses) or points (balance %d)",
+			h.promoCodes["LOYALTY10"].Uses, h.Points(1))
+	}
+}
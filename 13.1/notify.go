@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+type Notifier interface {
+	Send(to, subject, body string) error
+}
+
+type notificationTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var defaultNotificationTemplates = map[BookingState][2]string{
+	StateBookingConfirmed: {
+		"Booking {{.Reference}} confirmed",
+		"Your booking {{.Reference}} for room {{.Room.ID}} is confirmed.",
+	},
+	StatePaid: {
+		"Payment received for {{.Reference}}",
+		"We received {{printf \"%.2f\" .Total}} for booking {{.Reference}}. Thank you!",
+	},
+	StateBookingCancelled: {
+		"Booking {{.Reference}} cancelled",
+		"Your booking {{.Reference}} has been cancelled.",
+	},
+}
+
+func (h *HotelBookingSystem) SetNotifier(n Notifier) {
+	h.notifier = n
+}
+
+// SetNotificationTemplate sets the message sent to the guest when a booking
+// enters state. Subject and body are text/template strings executed with the
+// booking.
+func (h *HotelBookingSystem) SetNotificationTemplate(state BookingState, subject, body string) error {
+	subj, err := template.New(string(state) + "-subject").Parse(subject)
+	if err != nil {
+		return fmt.Errorf("parse subject for %s: %w", state, err)
+	}
+	text, err := template.New(string(state) + "-body").Parse(body)
+	if err != nil {
+		return fmt.Errorf("parse body for %s: %w", state, err)
+	}
+	h.templates[state] = notificationTemplate{subject: subj, body: text}
+	return nil
+}
+
+// notify sends the template for state to the booking's contact. Delivery
+// failures are reported but do not undo the transition.
+func (h *HotelBookingSystem) notify(b *Booking, state BookingState) {
+	tmpl, ok := h.templates[state]
+	if h.notifier == nil || !ok || b.Contact == "" {
+		return
+	}
+	var subject, body strings.Builder
+	if err := tmpl.subject.Execute(&subject, b); err != nil {
+		fmt.Printf("Booking #%d: notification not rendered: %v\n", b.ID, err)
+		return
+	}
+	if err := tmpl.body.Execute(&body, b); err != nil {
+		fmt.Printf("Booking #%d: notification not rendered: %v\n", b.ID, err)
+		return
+	}
+	if err := h.notifier.Send(b.Contact, subject.String(), body.String()); err != nil {
+		fmt.Printf("Booking #%d: notification to %s failed: %v\n", b.ID, b.Contact, err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type sentMessage struct {
+	to, subject, body string
+}
+
+type stubNotifier struct {
+	sent []sentMessage
+	err  error
+}
+
+func (n *stubNotifier) Send(to, subject, body string) error {
+	n.sent = append(n.sent, sentMessage{to, subject, body})
+	return n.err
+}
+
+func TestNotifierSendsTemplatedMessages(t *testing.T) {
+	h, _ := newTestSystem()
+	n := &stubNotifier{}
+	h.SetNotifier(n)
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	b, _ := h.NewBooking(1)
+	b.Contact = "guest@example.com"
+	b.CheckInDate, b.CheckOutDate = day(10), day(11)
+	mustTransition(t, h, b, EventSelectRoom, room, "")
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+
+	if len(n.sent) != 2 {
+		t.Fatalf("sent %d messages, want confirmation and receipt", len(n.sent))
+	}
+	if m := n.sent[0]; m.to != b.Contact || m.subject != "Booking "+b.Reference+" confirmed" {
+		t.Errorf("confirmation = %+v", m)
+	}
+	if m := n.sent[1]; !strings.Contains(m.body, "5000.00") || !strings.Contains(m.body, b.Reference) {
+		t.Errorf("receipt body = %q, want the total and reference", m.body)
+	}
+}
+
+func TestCustomTemplateAndFailedDelivery(t *testing.T) {
+	h, _ := newTestSystem()
+	n := &stubNotifier{err: errors.New("mailbox full")}
+	h.SetNotifier(n)
+	if err := h.SetNotificationTemplate(StateBookingCancelled, "Cancelled: {{.Reference}}", "Room {{.Room.ID}} released."); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetNotificationTemplate(StatePaid, "{{.Nope", "x"); err == nil {
+		t.Error("malformed template accepted")
+	}
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	b.Contact = "guest@example.com"
+	mustTransition(t, h, b, EventCancel, nil, "")
+
+	if len(n.sent) != 1 || n.sent[0].subject != "Cancelled: "+b.Reference || n.sent[0].body != "Room 101 released." {
+		t.Errorf("sent %+v, want the custom cancellation", n.sent)
+	}
+	if b.State != StateBookingCancelled {
+		t.Errorf("failed delivery left state %s", b.State)
+	}
+}
+
+func TestCloneDoesNotNotify(t *testing.T) {
+	h, _ := newTestSystem()
+	n := &stubNotifier{}
+	h.SetNotifier(n)
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	b.Contact = "guest@example.com"
+
+	c := h.Clone()
+	mustTransition(t, c, c.bookings[b.ID], EventConfirmBooking, nil, "")
+	if len(n.sent) != 0 {
+		t.Errorf("clone sent %d messages, want none", len(n.sent))
+	}
+}
+
+func TestConfirmAndPayNotifiesOnlyWhenPaid(t *testing.T) {
+	h, _ := newTestSystem()
+	n := &stubNotifier{}
+	h.SetNotifier(n)
+	entered := 0
+	h.OnEnterState(StateBookingConfirmed, func(*Booking) { entered++ })
+	declined := errors.New("card declined")
+	decline := true
+	h.AddGuard(func(b *Booking, event BookingEvent) error {
+		if event == EventPay && decline {
+			return declined
+		}
+		return nil
+	})
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	b.Contact = "guest@example.com"
+
+	if err := h.ConfirmAndPay(b, ""); !errors.Is(err, declined) {
+		t.Fatalf("ConfirmAndPay error = %v, want %v", err, declined)
+	}
+	if len(n.sent) != 0 || entered != 0 {
+		t.Fatalf("failed payment sent %d messages and ran the entry action %d times, want none", len(n.sent), entered)
+	}
+
+	decline = false
+	if err := h.ConfirmAndPay(b, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.sent) != 2 || entered != 1 {
+		t.Fatalf("sent %d messages, entry action ran %d times; want 2 and 1", len(n.sent), entered)
+	}
+	if !strings.HasSuffix(n.sent[0].subject, " confirmed") || !strings.HasPrefix(n.sent[1].subject, "Payment received") {
+		t.Errorf("subjects %q, %q; want the confirmation, then the receipt", n.sent[0].subject, n.sent[1].subject)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+// MakeOffer submits the guest's offer of price as the nightly (or hourly)
+// room rate of a booking with a selected room.
+func (h *HotelBookingSystem) MakeOffer(b *Booking, price float64) error {
+	return h.setOffer(b, EventOffer, price)
+}
+
+// Counter replaces the open offer on the booking with price.
+func (h *HotelBookingSystem) Counter(b *Booking, price float64) error {
+	return h.setOffer(b, EventCounter, price)
+}
+
+func (h *HotelBookingSystem) setOffer(b *Booking, event BookingEvent, price float64) error {
+	previous := b.OfferPrice
+	b.OfferPrice = price
+	if err := h.Transition(b, event, nil, ""); err != nil {
+		b.OfferPrice = previous
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultSurgeThreshold = 0.8
+	defaultSurgePercent   = 20.0
+
+	defaultWeeklyDiscountNights  = 7
+	defaultWeeklyDiscountPercent = 10.0
+
+	defaultNonRefundableDiscountPercent = 10.0
+	defaultPriceDriftTolerancePercent   = 5.0
+	defaultAgentCommissionPercent       = 8.0
+	defaultInsurancePercent             = 5.0
+)
+
+var defaultWeekendDays = []time.Weekday{time.Saturday, time.Sunday}
+
+type RateType string
+
+const (
+	RateRefundable    RateType = "refundable"
+	RateNonRefundable RateType = "nonRefundable"
+)
+
+// Occupancy returns the share of rooms in the inventory held by bookings
+// whose stay intersects [checkIn, checkOut). The booking passed as exclude,
+// if any, is not counted.
+func (h *HotelBookingSystem) Occupancy(checkIn, checkOut time.Time, exclude *Booking) float64 {
+	if len(h.rooms) == 0 {
+		return 0
+	}
+	window := &Booking{CheckInDate: checkIn, CheckOutDate: checkOut}
+	occupied := make(map[int]bool)
+	for _, b := range h.bookings {
+		if b == exclude || !b.holdsRoom() {
+			continue
+		}
+		if _, known := h.rooms[b.Room.ID]; known && b.overlaps(window) {
+			occupied[b.Room.ID] = true
+		}
+	}
+	return float64(len(occupied)) / float64(len(h.rooms))
+}
+
+// SurgeMultiplier returns the price multiplier for the given occupancy.
+func (h *HotelBookingSystem) SurgeMultiplier(occupancy float64) float64 {
+	if h.SurgePercent <= 0 || occupancy <= h.SurgeThreshold {
+		return 1
+	}
+	return 1 + h.SurgePercent/100
+}
+
+// isWeekend reports whether day, a hotel-local date, is one of WeekendDays.
+func (h *HotelBookingSystem) isWeekend(day time.Time) bool {
+	for _, d := range h.WeekendDays {
+		if day.Weekday() == d {
+			return true
+		}
+	}
+	return false
+}
+
+// pricedNights returns how many nights of the room rate a nightly stay is
+// charged, with each night starting on a weekend day counted as
+// 1 + WeekendPercent/100. It is zero when the stay has no dates.
+func (h *HotelBookingSystem) pricedNights(b *Booking) float64 {
+	nights := 0.0
+	for _, day := range h.stayDays(b) {
+		nights++
+		if h.WeekendPercent > 0 && h.isWeekend(day) {
+			nights += h.WeekendPercent / 100
+		}
+	}
+	return nights
+}
+
+// rateOf returns the rate the booking pays for r: the hourly rate for
+// hourly bookings and the nightly room price otherwise.
+func (b *Booking) rateOf(r *Room) float64 {
+	if b.Kind == KindHourly {
+		return r.HourlyRate
+	}
+	return r.Price
+}
+
+// PriceFor returns the price of the booking's room before discounts,
+// adjusted for occupancy over the booking's dates. Nightly bookings are
+// charged for every night, with the weekend surcharge on weekend nights, and
+// once when they have no dates yet; hourly
+// bookings for every started hour. Confirmed bookings keep the room rate
+// locked in at confirmation.
+func (h *HotelBookingSystem) PriceFor(b *Booking) float64 {
+	if b.Room == nil {
+		return 0
+	}
+	price := b.rateOf(b.Room)
+	if b.RoomRate > 0 {
+		price = b.RoomRate
+	}
+	if b.Kind == KindHourly {
+		price *= math.Ceil(b.CheckOutDate.Sub(b.CheckInDate).Hours())
+	} else if nights := h.pricedNights(b); nights > 0 {
+		price *= nights
+	}
+	price *= 1 - b.RateDiscountPercent/100
+	if b.hasDates() {
+		price *= h.SurgeMultiplier(h.Occupancy(b.CheckInDate, b.CheckOutDate, b))
+	}
+	return price
+}
+
+// subtotal returns the booking's charges before discounts.
+func (h *HotelBookingSystem) subtotal(b *Booking) float64 {
+	return h.PriceFor(b) + h.addOnsTotal(b) + h.guestCharges(b) + b.ModificationFees
+}
+
+// PriceDrift returns how much the booking's charge differs from
+// originalQuote: the paid total once paid, and the current subtotal before
+// that. A drift beyond PriceDriftTolerancePercent of the quote marks the
+// booking as requiring reconfirmation.
+func (h *HotelBookingSystem) PriceDrift(b *Booking, originalQuote float64) float64 {
+	current := h.subtotal(b)
+	if !b.PaidAt.IsZero() {
+		current = b.Total
+	}
+	drift := current - originalQuote
+	b.RequiresReconfirmation = math.Abs(drift) > originalQuote*h.PriceDriftTolerancePercent/100
+	return drift
+}
+
+// SelectRate sets the booking's rate type together with its price adjustment
+// and refundability. The rate can be changed until the booking is confirmed.
+func (h *HotelBookingSystem) SelectRate(b *Booking, rate RateType) error {
+	switch b.State {
+	case StateIdle, StateQuoted, StateRoomSelected:
+	default:
+		return fmt.Errorf("cannot change the rate of booking #%d in state %s", b.ID, b.State)
+	}
+	switch rate {
+	case RateRefundable:
+		b.NonRefundable, b.RateDiscountPercent = false, 0
+	case RateNonRefundable:
+		b.NonRefundable, b.RateDiscountPercent = true, h.NonRefundableDiscountPercent
+	default:
+		return fmt.Errorf("unknown rate type: %s", rate)
+	}
+	b.RateType = rate
+	return nil
+}
+
+// SetRoomTypePrice changes the price of every room of the given type and
+// returns how many rooms were updated.
+func (h *HotelBookingSystem) SetRoomTypePrice(roomType string, newPrice float64) (int, error) {
+	if newPrice <= 0 {
+		return 0, fmt.Errorf("price must be positive, got %.2f", newPrice)
+	}
+	changed := 0
+	for _, r := range h.rooms {
+		if r.Type == roomType {
+			r.Price = newPrice
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// SimulatePriceChange returns how the charges before discounts of confirmed,
+// unpaid bookings on roomType would change if the type were priced at
+// newPrice and their rates were not locked. The system is left unchanged.
+func (h *HotelBookingSystem) SimulatePriceChange(roomType string, newPrice float64) (delta float64) {
+	c := h.Clone()
+	var pending []*Booking
+	for _, b := range c.sortedBookings() {
+		if b.State == StateBookingConfirmed && b.Room != nil && b.Room.Type == roomType {
+			b.RoomRate = 0
+			pending = append(pending, b)
+			delta -= c.subtotal(b)
+		}
+	}
+	if _, err := c.SetRoomTypePrice(roomType, newPrice); err != nil {
+		return 0
+	}
+	for _, b := range pending {
+		delta += c.subtotal(b)
+	}
+	return RoundMoney(delta, h.Currency)
+}
+
+type AddOn struct {
+	Name     string
+	Price    float64
+	PerNight bool
+}
+
+func (h *HotelBookingSystem) AddAddOn(b *Booking, addon AddOn) error {
+	if b.State == StatePaid || b.State == StateBookingCancelled {
+		return fmt.Errorf("cannot add %s to booking #%d in state %s", addon.Name, b.ID, b.State)
+	}
+	if addon.Price < 0 {
+		return fmt.Errorf("add-on %s has negative price", addon.Name)
+	}
+	b.AddOns = append(b.AddOns, addon)
+	return nil
+}
+
+// addOnsTotal sums the booking's add-ons. Per-night add-ons are charged for
+// every night of the stay, and once for a booking without dates.
+func (h *HotelBookingSystem) addOnsTotal(b *Booking) float64 {
+	nights := h.Nights(b)
+	if nights < 1 {
+		nights = 1
+	}
+	total := 0.0
+	for _, a := range b.AddOns {
+		if a.PerNight {
+			total += a.Price * float64(nights)
+		} else {
+			total += a.Price
+		}
+	}
+	return total
+}
+
+type GiftCard struct {
+	Code    string
+	Balance float64
+}
+
+// RedeemGiftCard sets the gift card the booking is partly paid with. When
+// the booking is paid, as much of the total as the card's balance covers is
+// taken off it, and the rest is charged by the payment method.
+func (h *HotelBookingSystem) RedeemGiftCard(b *Booking, card *GiftCard) error {
+	if b.State != StateRoomSelected && b.State != StateBookingConfirmed {
+		return fmt.Errorf("gift card can only be redeemed on a booking awaiting payment")
+	}
+	if card.Balance <= 0 {
+		return fmt.Errorf("gift card %s has no balance", card.Code)
+	}
+	b.GiftCard = card
+	return nil
+}
+
+type Credit struct {
+	Amount float64
+	Reason string
+	At     time.Time
+}
+
+// NetTotal returns what the hotel keeps from the booking after refunds and
+// credits.
+func (b *Booking) NetTotal() float64 {
+	net := b.Total - b.RefundedAmount
+	for _, c := range b.Credits {
+		net -= c.Amount
+	}
+	return net
+}
+
+// EffectivePrice returns the revenue the booking has actually realized: its
+// net total plus overstay charges, or zero if it was never paid.
+func (h *HotelBookingSystem) EffectivePrice(b *Booking) float64 {
+	if b.PaidAt.IsZero() {
+		return 0
+	}
+	return RoundMoney(b.NetTotal()+b.BalanceDue, h.Currency)
+}
+
+// ApplyCredit records a goodwill credit on a paid booking without changing
+// its state.
+func (h *HotelBookingSystem) ApplyCredit(b *Booking, amount float64, reason string) error {
+	if !b.isPaid() {
+		return fmt.Errorf("credit can only be applied to a paid booking")
+	}
+	if amount <= 0 {
+		return fmt.Errorf("credit amount must be positive, got %.2f", amount)
+	}
+	if amount > b.NetTotal() {
+		return fmt.Errorf("credit %.2f exceeds net total %.2f of booking #%d", amount, b.NetTotal(), b.ID)
+	}
+	b.Credits = append(b.Credits, Credit{Amount: amount, Reason: reason, At: h.now()})
+	fmt.Printf("Booking #%d: credit %.0f applied (%s), net total: %.0f\n", b.ID, amount, reason, b.NetTotal())
+	return nil
+}
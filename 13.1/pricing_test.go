@@ -0,0 +1,328 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSurgePricingAtLowAndHighOccupancy(t *testing.T) {
+	h, _ := newTestSystem()
+	var rooms []*Room
+	for id := 1; id <= 6; id++ {
+		rooms = append(rooms, addRoom(t, h, &Room{ID: id, Type: "standard", Price: 5000}))
+	}
+
+	quiet := selectStay(t, h, 1, rooms[0], 10, 1)
+	if got := h.PriceFor(quiet); got != 5000 {
+		t.Errorf("price at low occupancy = %.2f, want 5000", got)
+	}
+
+	for i, r := range rooms[1:] {
+		selectStay(t, h, 10+i, r, 20, 1)
+	}
+	busy := selectStay(t, h, 2, rooms[0], 20, 1)
+	if got := h.PriceFor(busy); got != 6000 {
+		t.Errorf("price at high occupancy = %.2f, want 6000", got)
+	}
+	mustTransition(t, h, busy, EventConfirmBooking, nil, "")
+	mustTransition(t, h, busy, EventPay, nil, "")
+	if busy.Total != 6000 {
+		t.Errorf("paid total at high occupancy = %.2f, want 6000", busy.Total)
+	}
+}
+
+func TestAddOnsIncludedInPayment(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 3)
+	if err := h.AddAddOn(b, AddOn{Name: "breakfast", Price: 800, PerNight: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddAddOn(b, AddOn{Name: "parking", Price: 1500}); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+
+	// 3 nights of room and breakfast, and parking once.
+	if want := 3*5000.0 + 3*800 + 1500; b.Total != want {
+		t.Errorf("Total = %.2f, want %.2f", b.Total, want)
+	}
+	if err := h.AddAddOn(b, AddOn{Name: "late checkout", Price: 1000}); err == nil {
+		t.Error("add-on accepted on a paid booking")
+	}
+}
+
+func TestRedeemGiftCards(t *testing.T) {
+	h, _ := newTestSystem()
+	h.AgentCommissionPercent = 10
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	pay := func(userID, from int, card *GiftCard) *Booking {
+		b := selectStay(t, h, userID, room, from, 2)
+		b.AgentID = 7
+		if err := h.RedeemGiftCard(b, card); err != nil {
+			t.Fatal(err)
+		}
+		mustTransition(t, h, b, EventConfirmBooking, nil, "")
+		mustTransition(t, h, b, EventPay, nil, "")
+		return b
+	}
+
+	small := &GiftCard{Code: "GC1", Balance: 3000}
+	partly := pay(1, 10, small)
+	if small.Balance != 0 || partly.GiftCardPaid != 3000 || partly.Total != 7000 {
+		t.Errorf("small card: balance %.2f, paid %.2f, total %.2f; want 0, 3000, 7000",
+			small.Balance, partly.GiftCardPaid, partly.Total)
+	}
+	if partly.ChargedAmount != 7000 || partly.Commission != 700 {
+		t.Errorf("small card: charged %.2f, commission %.2f; want 7000, 700", partly.ChargedAmount, partly.Commission)
+	}
+
+	large := &GiftCard{Code: "GC2", Balance: 20000}
+	fully := pay(2, 12, large)
+	if large.Balance != 10000 || fully.GiftCardPaid != 10000 || fully.Total != 0 || fully.ChargedAmount != 0 {
+		t.Errorf("large card: balance %.2f, paid %.2f, total %.2f, charged %.2f; want 10000, 10000, 0, 0",
+			large.Balance, fully.GiftCardPaid, fully.Total, fully.ChargedAmount)
+	}
+
+	b := selectStay(t, h, 3, room, 14, 1)
+	if err := h.RedeemGiftCard(b, small); err == nil {
+		t.Error("empty card redeemed")
+	}
+	if err := h.RedeemGiftCard(fully, large); err == nil {
+		t.Error("card redeemed on a paid booking")
+	}
+}
+
+func TestSetRoomTypePriceKeepsLockedRates(t *testing.T) {
+	h, _ := newTestSystem()
+	a := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	suite := addRoom(t, h, &Room{ID: 301, Type: "suite", Price: 20000})
+	confirmed := selectStay(t, h, 1, a, 10, 1)
+	mustTransition(t, h, confirmed, EventConfirmBooking, nil, "")
+
+	if _, err := h.SetRoomTypePrice("standard", 0); err == nil {
+		t.Error("zero price accepted")
+	}
+	n, err := h.SetRoomTypePrice("standard", 6000)
+	if err != nil || n != 2 {
+		t.Fatalf("SetRoomTypePrice = %d, %v; want 2 rooms", n, err)
+	}
+	if suite.Price != 20000 {
+		t.Errorf("suite price changed to %.2f", suite.Price)
+	}
+
+	newer := selectStay(t, h, 2, b, 10, 1)
+	if got := h.PriceFor(newer); got != 6000 {
+		t.Errorf("new booking price = %.2f, want 6000", got)
+	}
+	mustTransition(t, h, confirmed, EventPay, nil, "")
+	if confirmed.Total != 5000 {
+		t.Errorf("confirmed booking paid %.2f, want its locked 5000", confirmed.Total)
+	}
+}
+
+func TestHourlyDayUseBooking(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000, HourlyRate: 900})
+	b, _ := h.NewBooking(1)
+	b.Kind = KindHourly
+	b.CheckInDate = day(10).Add(11 * time.Hour)
+	b.CheckOutDate = b.CheckInDate.Add(3 * time.Hour)
+	mustTransition(t, h, b, EventSelectRoom, room, "")
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	if b.Total != 2700 {
+		t.Errorf("3-hour total = %.2f, want 2700", b.Total)
+	}
+
+	if free := h.AvailableRooms(b.CheckOutDate.Add(-time.Hour), b.CheckOutDate.Add(time.Hour)); len(free) != 0 {
+		t.Error("room free during the last hour of the day-use booking")
+	}
+	if free := h.AvailableRooms(b.CheckOutDate, b.CheckOutDate.Add(2*time.Hour)); len(free) != 1 {
+		t.Error("room not free right after the day-use booking")
+	}
+}
+
+func TestNonRefundableRate(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	flexible := payStay(t, h, 1, room, 10, 2)
+	saver := selectStay(t, h, 2, room, 20, 2)
+	if err := h.SelectRate(saver, RateNonRefundable); err != nil {
+		t.Fatal(err)
+	}
+	if !saver.NonRefundable || saver.RateType != RateNonRefundable {
+		t.Errorf("rate %s, NonRefundable %v; want both set", saver.RateType, saver.NonRefundable)
+	}
+	mustTransition(t, h, saver, EventConfirmBooking, nil, "")
+	if err := h.SelectRate(saver, RateRefundable); err == nil {
+		t.Error("rate changed after confirmation")
+	}
+	mustTransition(t, h, saver, EventPay, nil, "")
+
+	if saver.Total != 9000 || saver.Total >= flexible.Total {
+		t.Errorf("non-refundable total %.2f, refundable %.2f; want 9000 and cheaper", saver.Total, flexible.Total)
+	}
+	if err := h.Transition(saver, EventRefund, nil, ""); err == nil {
+		t.Error("non-refundable booking was refunded")
+	}
+	mustTransition(t, h, flexible, EventRefund, nil, "")
+}
+
+func TestApplyCreditReducesNetTotal(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 10, 2)
+
+	if err := h.ApplyCredit(b, 1500, "noisy room"); err != nil {
+		t.Fatal(err)
+	}
+	if b.State != StatePaid || b.Total != 10000 || b.NetTotal() != 8500 {
+		t.Errorf("state %s, total %.2f, net %.2f; want Paid, 10000, 8500", b.State, b.Total, b.NetTotal())
+	}
+	if len(b.Credits) != 1 || b.Credits[0].Reason != "noisy room" || !b.Credits[0].At.Equal(testNow) {
+		t.Errorf("credits = %+v, want one noisy room credit at %v", b.Credits, testNow)
+	}
+	if err := h.ApplyCredit(b, 9000, "too much"); err == nil {
+		t.Error("credit above the net total accepted")
+	}
+
+	unpaid := selectStay(t, h, 2, room, 20, 1)
+	if err := h.ApplyCredit(unpaid, 100, "early"); err == nil {
+		t.Error("credit accepted on an unpaid booking")
+	}
+}
+
+func TestPriceDriftBeyondTolerance(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	b, _ := h.NewBooking(1)
+	mustTransition(t, h, b, EventQuote, room, "")
+	quoted := b.QuotedPrice
+	mustTransition(t, h, b, EventAccept, nil, "")
+
+	room.Price = 10400
+	if drift := h.PriceDrift(b, quoted); drift != 400 || b.RequiresReconfirmation {
+		t.Errorf("drift %.2f, reconfirm %v; want 400 within tolerance", drift, b.RequiresReconfirmation)
+	}
+	room.Price = 11000
+	if drift := h.PriceDrift(b, quoted); drift != 1000 || !b.RequiresReconfirmation {
+		t.Errorf("drift %.2f, reconfirm %v; want 1000 beyond tolerance", drift, b.RequiresReconfirmation)
+	}
+
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "LOYALTY10")
+	if drift := h.PriceDrift(b, quoted); drift != -100 || b.RequiresReconfirmation {
+		t.Errorf("paid drift %.2f, reconfirm %v; want -100 within tolerance", drift, b.RequiresReconfirmation)
+	}
+}
+
+func TestInsuredNonRefundableBookingRefundedInFull(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 1, 2)
+	if err := h.SelectRate(b, RateNonRefundable); err != nil {
+		t.Fatal(err)
+	}
+	b.Insured = true
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	if b.InsuranceFee != 450 || b.Total != 9450 {
+		t.Errorf("insurance %.2f, total %.2f; want 450 on top of 9000", b.InsuranceFee, b.Total)
+	}
+
+	clock.now = day(1).Add(13 * time.Hour)
+	mustTransition(t, h, b, EventRefund, nil, "")
+	if b.RefundedAmount != b.Total {
+		t.Errorf("refunded %.2f of %.2f, want the full total", b.RefundedAmount, b.Total)
+	}
+}
+
+func TestSimulatePriceChangeOnPendingBookings(t *testing.T) {
+	h, _ := newTestSystem()
+	a := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	deluxe := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	for _, stay := range []struct {
+		room         *Room
+		from, nights int
+	}{{a, 10, 2}, {b, 10, 1}, {deluxe, 10, 1}} {
+		mustTransition(t, h, selectStay(t, h, 1, stay.room, stay.from, stay.nights), EventConfirmBooking, nil, "")
+	}
+	payStay(t, h, 2, a, 20, 3)
+	selectStay(t, h, 3, b, 20, 3)
+	auditLen := len(h.audit)
+
+	// Two confirmed standard stays of 3 nights in total, 500 more a night.
+	if got := h.SimulatePriceChange("standard", 5500); got != 1500 {
+		t.Errorf("SimulatePriceChange = %.2f, want 1500", got)
+	}
+	if got := h.SimulatePriceChange("standard", 4000); got != -3000 {
+		t.Errorf("SimulatePriceChange down = %.2f, want -3000", got)
+	}
+	if a.Price != 5000 || b.Price != 5000 || len(h.audit) != auditLen {
+		t.Error("SimulatePriceChange changed the system")
+	}
+	for _, booking := range h.bookings {
+		if booking.State == StateBookingConfirmed && booking.RoomRate == 0 {
+			t.Errorf("booking #%d lost its locked rate", booking.ID)
+		}
+	}
+}
+
+func TestEffectivePrice(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	stayed := payStay(t, h, 1, room, 1, 2)
+	if err := h.ApplyCredit(stayed, 1000, "noisy corridor"); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, stayed, EventCheckIn, nil, "")
+	h.ChargeOverstays(day(4).Add(10 * time.Hour))
+	// 10000 paid, less the 1000 credit, plus one 5000 overstay night.
+	if got := h.EffectivePrice(stayed); got != 14000 {
+		t.Errorf("EffectivePrice(credited overstay) = %.0f, want 14000", got)
+	}
+
+	refunded := payStay(t, h, 2, room, 5, 1)
+	mustTransition(t, h, refunded, EventRefund, nil, "")
+	if got := h.EffectivePrice(refunded); got != 0 {
+		t.Errorf("EffectivePrice(refunded) = %.0f, want 0", got)
+	}
+
+	unpaid := selectStay(t, h, 3, room, 7, 1)
+	mustTransition(t, h, unpaid, EventConfirmBooking, nil, "")
+	if got := h.EffectivePrice(unpaid); got != 0 {
+		t.Errorf("EffectivePrice(unpaid) = %.0f, want 0", got)
+	}
+}
+
+func TestWeekendSurchargeFollowsWeekendDays(t *testing.T) {
+	h, _ := newTestSystem()
+	h.WeekendPercent = 50
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	if day(3).Weekday() != time.Thursday {
+		t.Fatalf("day 3 is a %s, want Thursday", day(3).Weekday())
+	}
+	thuFri := selectStay(t, h, 1, room, 3, 2)
+	sunday := selectStay(t, h, 2, room, 6, 1)
+
+	if got := h.PriceFor(thuFri); got != 10000 {
+		t.Errorf("Thursday-Friday with a Saturday-Sunday weekend = %.0f, want 10000", got)
+	}
+	if got := h.PriceFor(sunday); got != 7500 {
+		t.Errorf("Sunday with a Saturday-Sunday weekend = %.0f, want 7500", got)
+	}
+
+	h.WeekendDays = []time.Weekday{time.Friday, time.Saturday}
+	if got := h.PriceFor(thuFri); got != 12500 {
+		t.Errorf("Thursday-Friday with a Friday-Saturday weekend = %.0f, want 12500", got)
+	}
+	if got := h.PriceFor(sunday); got != 5000 {
+		t.Errorf("Sunday with a Friday-Saturday weekend = %.0f, want 5000", got)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PromoCode struct {
+	Code          string
+	Percentage    float64
+	FixedAmount   float64
+	FirstTimeOnly bool
+	// Stackable codes may be combined with other stackable codes.
+	Stackable bool
+
+	// Zero values mean no limit.
+	ExpiresAt time.Time
+	MaxUses   int
+	RoomTypes []string
+	MinSpend  float64
+
+	// EligibleUsers limits the code to the listed users when non-empty.
+	EligibleUsers map[int]bool
+
+	Uses int
+}
+
+var defaultPromoCodes = []PromoCode{
+	{Code: "LOYALTY10", Percentage: 10},
+	{Code: "HOLIDAY15", Percentage: 15},
+}
+
+func (p *PromoCode) describe() string {
+	var parts []string
+	if p.Percentage > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f%%", p.Percentage))
+	}
+	if p.FixedAmount > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f", p.FixedAmount))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " + ")
+}
+
+// copy returns p with its room types and eligible users copied, so changes to
+// the copy never reach p.
+func (p *PromoCode) copy() PromoCode {
+	cp := *p
+	cp.RoomTypes = append([]string(nil), p.RoomTypes...)
+	if p.EligibleUsers != nil {
+		cp.EligibleUsers = make(map[int]bool, len(p.EligibleUsers))
+		for id := range p.EligibleUsers {
+			cp.EligibleUsers[id] = true
+		}
+	}
+	return cp
+}
+
+func validatePromoCode(p PromoCode) error {
+	if p.Code == "" {
+		return fmt.Errorf("promo code must not be empty")
+	}
+	for _, r := range p.Code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("promo code %q must contain only uppercase letters and digits", p.Code)
+		}
+	}
+	if p.Percentage < 0 || p.Percentage > 100 {
+		return fmt.Errorf("promo code %s: percentage %.2f is outside 0-100", p.Code, p.Percentage)
+	}
+	if p.FixedAmount < 0 {
+		return fmt.Errorf("promo code %s: fixed amount %.2f is negative", p.Code, p.FixedAmount)
+	}
+	if p.MaxUses < 0 {
+		return fmt.Errorf("promo code %s: max uses %d is negative", p.Code, p.MaxUses)
+	}
+	if p.MinSpend < 0 {
+		return fmt.Errorf("promo code %s: minimum spend %.2f is negative", p.Code, p.MinSpend)
+	}
+	return nil
+}
+
+func (h *HotelBookingSystem) RegisterPromoCode(p PromoCode) error {
+	if err := validatePromoCode(p); err != nil {
+		return err
+	}
+	if _, exists := h.promoCodes[p.Code]; exists {
+		return fmt.Errorf("promo code %s is already registered", p.Code)
+	}
+	h.promoCodes[p.Code] = &p
+	return nil
+}
+
+// UpdatePromoCode changes a registered code through updater. The changes are
+// made on a copy and only take effect if the result is still valid.
+func (h *HotelBookingSystem) UpdatePromoCode(code string, updater func(*PromoCode)) error {
+	current, ok := h.promoCodes[code]
+	if !ok {
+		return fmt.Errorf("%s: %w", code, ErrPromoNotFound)
+	}
+	updated := current.copy()
+	updater(&updated)
+	if updated.Code != code {
+		return fmt.Errorf("promo code %s cannot be renamed to %s", code, updated.Code)
+	}
+	if err := validatePromoCode(updated); err != nil {
+		return err
+	}
+	h.promoCodes[code] = &updated
+	return nil
+}
+
+// AssignPromoToUsers makes the code usable only by the given users, in
+// addition to any assigned before.
+func (h *HotelBookingSystem) AssignPromoToUsers(code string, userIDs []int) error {
+	promo, ok := h.promoCodes[code]
+	if !ok {
+		return fmt.Errorf("%s: %w", code, ErrPromoNotFound)
+	}
+	if promo.EligibleUsers == nil {
+		promo.EligibleUsers = make(map[int]bool, len(userIDs))
+	}
+	for _, id := range userIDs {
+		promo.EligibleUsers[id] = true
+	}
+	return nil
+}
+
+// CheckPromo reports why the code cannot be applied to the booking at the
+// given time, or nil if it can.
+func (h *HotelBookingSystem) CheckPromo(code string, b *Booking, at time.Time) error {
+	promo, ok := h.promoCodes[code]
+	if !ok {
+		return fmt.Errorf("%s: %w", code, ErrPromoNotFound)
+	}
+	if !promo.ExpiresAt.IsZero() && at.After(promo.ExpiresAt) {
+		return fmt.Errorf("%s: %w on %s", code, ErrPromoExpired, promo.ExpiresAt.Format(dateLayout))
+	}
+	if promo.MaxUses > 0 && promo.Uses >= promo.MaxUses {
+		return fmt.Errorf("%s: %w", code, ErrPromoExhausted)
+	}
+	if len(promo.RoomTypes) > 0 && (b.Room == nil || !containsString(promo.RoomTypes, b.Room.Type)) {
+		return fmt.Errorf("%s: %w", code, ErrPromoRoomType)
+	}
+	if promo.MinSpend > 0 && h.subtotal(b) < promo.MinSpend {
+		return fmt.Errorf("%s: %w of %.0f", code, ErrPromoMinSpend, promo.MinSpend)
+	}
+	if len(promo.EligibleUsers) > 0 && !promo.EligibleUsers[b.UserID] {
+		return fmt.Errorf("%s: %w", code, ErrPromoNotEligible)
+	}
+	if promo.FirstTimeOnly && h.hasPriorPayment(b) {
+		return fmt.Errorf("%s: %w", code, ErrPromoFirstTimeOnly)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinPromoCodes combines several stackable codes into the single promo code
+// argument taken by Transition and ConfirmAndPay, for example the result of
+// BestPromoCombination.
+func JoinPromoCodes(codes []string) string {
+	return strings.Join(codes, ",")
+}
+
+// applyDiscounts applies the default discount, the weekly rate and the given
+// promo codes to subtotal. Percentages are added together and limited by
+// MaxDiscountPercent when it is set; fixed amounts are taken off afterwards.
+// When several codes are given, only stackable ones are used. It returns the
+// promo codes used; recording the uses is left to the caller once the
+// payment goes through.
+func (h *HotelBookingSystem) applyDiscounts(b *Booking, subtotal float64, promoCode string) (float64, []*PromoCode) {
+	percent, fixed := h.DefaultDiscountPercent, 0.0
+	if percent > 0 {
+		fmt.Printf("Default discount applied: %.0f%%\n", percent)
+	}
+	if h.weeklyDiscountApplies(b) {
+		percent += h.WeeklyDiscountPercent
+		fmt.Printf("Weekly rate applied: %.0f%%\n", h.WeeklyDiscountPercent)
+	}
+	var applied []*PromoCode
+	if promoCode == "" {
+		return h.discounted(subtotal, percent, fixed), nil
+	}
+	codes := strings.Split(promoCode, ",")
+	for _, code := range codes {
+		if err := h.CheckPromo(code, b, h.now()); err != nil {
+			fmt.Printf("Promo code %s not applied: %v\n", code, err)
+			continue
+		}
+		promo := h.promoCodes[code]
+		if len(codes) > 1 && !promo.Stackable {
+			fmt.Printf("Promo code %s not applied: it cannot be combined with other codes\n", code)
+			continue
+		}
+		if containsPromo(applied, promo) {
+			continue
+		}
+		applied = append(applied, promo)
+		percent += promo.Percentage
+		fixed += promo.FixedAmount
+		fmt.Printf("Promo code %s applied. Discount: %s\n", code, promo.describe())
+	}
+	return h.discounted(subtotal, percent, fixed), applied
+}
+
+func containsPromo(list []*PromoCode, p *PromoCode) bool {
+	for _, q := range list {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// baseDiscountPercent returns the discount the booking gets without any promo
+// code, before MaxDiscountPercent is applied.
+func (h *HotelBookingSystem) baseDiscountPercent(b *Booking) float64 {
+	percent := h.DefaultDiscountPercent
+	if h.weeklyDiscountApplies(b) {
+		percent += h.WeeklyDiscountPercent
+	}
+	return percent
+}
+
+func (h *HotelBookingSystem) weeklyDiscountApplies(b *Booking) bool {
+	return h.WeeklyDiscountPercent > 0 && h.WeeklyDiscountNights > 0 && h.Nights(b) >= h.WeeklyDiscountNights
+}
+
+// discounted takes percent, limited by MaxDiscountPercent, and then fixed off
+// subtotal, never going below zero.
+func (h *HotelBookingSystem) discounted(subtotal, percent, fixed float64) float64 {
+	if h.MaxDiscountPercent > 0 && percent > h.MaxDiscountPercent {
+		percent = h.MaxDiscountPercent
+	}
+	total := subtotal*(1-percent/100) - fixed
+	if total < 0 {
+		return 0
+	}
+	return total
+}
+
+// BestPromoCombination returns the codes from availableCodes that together
+// give the booking the largest discount at the given time, and that
+// discount. A non-stackable code is only ever used on its own. Codes that
+// cannot be applied to the booking are skipped, and ties go to fewer codes.
+// Pay with the result by passing it through JoinPromoCodes.
+func (h *HotelBookingSystem) BestPromoCombination(b *Booking, availableCodes []string, at time.Time) ([]string, float64) {
+	basePercent := h.baseDiscountPercent(b)
+	subtotal := h.subtotal(b)
+	discountOf := func(codes []string) float64 {
+		percent, fixed := basePercent, 0.0
+		for _, code := range codes {
+			percent += h.promoCodes[code].Percentage
+			fixed += h.promoCodes[code].FixedAmount
+		}
+		return subtotal - h.discounted(subtotal, percent, fixed)
+	}
+
+	var stackable []string
+	var best []string
+	bestDiscount := discountOf(nil)
+	consider := func(codes []string) {
+		if d := discountOf(codes); d > bestDiscount || (d == bestDiscount && len(codes) < len(best)) {
+			best, bestDiscount = codes, d
+		}
+	}
+	seen := make(map[string]bool)
+	for _, code := range availableCodes {
+		if seen[code] || h.CheckPromo(code, b, at) != nil {
+			continue
+		}
+		seen[code] = true
+		if h.promoCodes[code].Stackable {
+			stackable = append(stackable, code)
+		} else {
+			consider([]string{code})
+		}
+	}
+	for mask := 1; mask < 1<<len(stackable); mask++ {
+		var codes []string
+		for i, code := range stackable {
+			if mask&(1<<i) != 0 {
+				codes = append(codes, code)
+			}
+		}
+		consider(codes)
+	}
+	return best, RoundMoney(bestDiscount, h.Currency)
+}
+
+// hasPriorPayment reports whether the booking's user has paid for any other
+// booking in the history.
+func (h *HotelBookingSystem) hasPriorPayment(b *Booking) bool {
+	for _, other := range h.history.Bookings {
+		if other != b && other.UserID == b.UserID && !other.PaidAt.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// PromoUsage counts the paid bookings in the history that used each code.
+func (h *HotelBookingSystem) PromoUsage() map[string]int {
+	usage := make(map[string]int)
+	for _, b := range h.history.Bookings {
+		if b.AppliedPromo == "" || b.PaidAt.IsZero() {
+			continue
+		}
+		for _, code := range strings.Split(b.AppliedPromo, ",") {
+			usage[code]++
+		}
+	}
+	return usage
+}
+
+// PromoDiscountTotal sums what promo codes took off the paid bookings in the
+// history, on top of the discounts they would have had anyway.
+func (h *HotelBookingSystem) PromoDiscountTotal() float64 {
+	total := 0.0
+	for _, b := range h.history.Bookings {
+		if !b.PaidAt.IsZero() {
+			total += b.PromoDiscount
+		}
+	}
+	return RoundMoney(total, h.Currency)
+}
+
+// UnusedPromoCodes returns the registered codes no paid booking has used,
+// sorted alphabetically.
+func (h *HotelBookingSystem) UnusedPromoCodes() []string {
+	usage := h.PromoUsage()
+	var unused []string
+	for code := range h.promoCodes {
+		if usage[code] == 0 {
+			unused = append(unused, code)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+const generatedCodeLength = 6
+
+// GenerateCodes registers count new codes made of prefix and a random
+// suffix, each usable maxUses times, and returns them.
+func (h *HotelBookingSystem) GenerateCodes(prefix string, count int, pct float64, maxUses int) ([]string, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive, got %d", count)
+	}
+	template := PromoCode{Code: prefix + "X", Percentage: pct, MaxUses: maxUses}
+	if err := validatePromoCode(template); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, count)
+	for len(codes) < count {
+		suffix := make([]byte, generatedCodeLength)
+		for i := range suffix {
+			suffix[i] = referenceAlphabet[rand.Intn(len(referenceAlphabet))]
+		}
+		p := template
+		p.Code = prefix + string(suffix)
+		if _, exists := h.promoCodes[p.Code]; exists {
+			continue
+		}
+		if err := h.RegisterPromoCode(p); err != nil {
+			return codes, err
+		}
+		codes = append(codes, p.Code)
+	}
+	return codes, nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterPromoCodeValidation(t *testing.T) {
+	h, _ := newTestSystem()
+	if err := h.RegisterPromoCode(PromoCode{Code: "SPRING25", Percentage: 25, FixedAmount: 100}); err != nil {
+		t.Fatalf("valid code rejected: %v", err)
+	}
+
+	for _, p := range []PromoCode{
+		{Code: ""},
+		{Code: "spring"},
+		{Code: "SPRING-25"},
+		{Code: "OVER", Percentage: 101},
+		{Code: "UNDER", Percentage: -1},
+		{Code: "NEGATIVE", FixedAmount: -50},
+	} {
+		if err := h.RegisterPromoCode(p); err == nil {
+			t.Errorf("code %+v registered, want error", p)
+		}
+	}
+	if err := h.RegisterPromoCode(PromoCode{Code: "SPRING25", Percentage: 5}); err == nil {
+		t.Error("duplicate code registered")
+	}
+}
+
+func TestDefaultDiscountWithoutCode(t *testing.T) {
+	h, _ := newTestSystem()
+	h.DefaultDiscountPercent = 10
+	h.MaxDiscountPercent = 15
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	plain := payStay(t, h, 1, room, 10, 1)
+	if plain.Total != 4500 {
+		t.Errorf("total without code = %.2f, want 4500", plain.Total)
+	}
+
+	// 10% default and 10% from the code are capped at 15%.
+	coded := selectStay(t, h, 2, room, 12, 1)
+	mustTransition(t, h, coded, EventConfirmBooking, nil, "")
+	mustTransition(t, h, coded, EventPay, nil, "LOYALTY10")
+	if coded.Total != 4250 {
+		t.Errorf("total with code = %.2f, want 4250", coded.Total)
+	}
+
+	h.DefaultDiscountPercent = 0
+	if off := payStay(t, h, 3, room, 14, 1); off.Total != 5000 {
+		t.Errorf("total with default discount off = %.2f, want 5000", off.Total)
+	}
+}
+
+func TestWeeklyRate(t *testing.T) {
+	h, _ := newTestSystem()
+	h.MaxDiscountPercent = 15
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+
+	if b := payStay(t, h, 1, room, 1, 6); b.Total != 30000 {
+		t.Errorf("6-night total = %.2f, want 30000", b.Total)
+	}
+	if b := payStay(t, h, 2, room, 10, 7); b.Total != 31500 {
+		t.Errorf("7-night total = %.2f, want 31500 after the weekly rate", b.Total)
+	}
+
+	// The weekly rate and a promo code are capped together.
+	b := selectStay(t, h, 3, room, 20, 7)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "LOYALTY10")
+	if b.Total != 29750 {
+		t.Errorf("7-night total with promo = %.2f, want 29750", b.Total)
+	}
+}
+
+func TestFirstTimeOnlyPromo(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	if err := h.RegisterPromoCode(PromoCode{Code: "WELCOME20", Percentage: 20, FirstTimeOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := selectStay(t, h, 1, room, 10, 1)
+	if err := h.CheckPromo("WELCOME20", first, testNow); err != nil {
+		t.Fatalf("new guest's code rejected: %v", err)
+	}
+	mustTransition(t, h, first, EventConfirmBooking, nil, "")
+	mustTransition(t, h, first, EventPay, nil, "WELCOME20")
+	if first.Total != 4000 {
+		t.Errorf("first booking total = %.2f, want 4000", first.Total)
+	}
+
+	again := selectStay(t, h, 1, room, 20, 1)
+	if err := h.CheckPromo("WELCOME20", again, testNow); !errors.Is(err, ErrPromoFirstTimeOnly) {
+		t.Errorf("returning guest's code error = %v, want %v", err, ErrPromoFirstTimeOnly)
+	}
+	mustTransition(t, h, again, EventConfirmBooking, nil, "")
+	mustTransition(t, h, again, EventPay, nil, "WELCOME20")
+	if again.Total != 5000 || again.AppliedPromo != "" {
+		t.Errorf("returning guest paid %.2f with promo %q, want 5000 and none", again.Total, again.AppliedPromo)
+	}
+}
+
+func TestPromoUsageAndUnusedCodes(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	if err := h.RegisterPromoCode(PromoCode{Code: "SPRING5", Percentage: 5}); err != nil {
+		t.Fatal(err)
+	}
+	for i, code := range []string{"LOYALTY10", "LOYALTY10", "SPRING5"} {
+		b := selectStay(t, h, i+1, room, 10+i, 1)
+		mustTransition(t, h, b, EventConfirmBooking, nil, "")
+		mustTransition(t, h, b, EventPay, nil, code)
+	}
+	cancelled := selectStay(t, h, 9, room, 20, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+
+	usage := h.PromoUsage()
+	if len(usage) != 2 || usage["LOYALTY10"] != 2 || usage["SPRING5"] != 1 {
+		t.Errorf("PromoUsage = %v, want LOYALTY10:2 SPRING5:1", usage)
+	}
+	if unused := h.UnusedPromoCodes(); len(unused) != 1 || unused[0] != "HOLIDAY15" {
+		t.Errorf("UnusedPromoCodes = %v, want [HOLIDAY15]", unused)
+	}
+}
+
+func TestUpdatePromoCode(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	if err := h.UpdatePromoCode("LOYALTY10", func(p *PromoCode) { p.Percentage = 30 }); err != nil {
+		t.Fatal(err)
+	}
+	b := selectStay(t, h, 1, room, 10, 1)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "LOYALTY10")
+	if b.Total != 3500 {
+		t.Errorf("total with updated code = %.2f, want 3500", b.Total)
+	}
+
+	if err := h.UpdatePromoCode("MISSING", func(p *PromoCode) {}); !errors.Is(err, ErrPromoNotFound) {
+		t.Errorf("update of a missing code error = %v, want %v", err, ErrPromoNotFound)
+	}
+}
+
+func TestUpdatePromoCodeRejectedLeavesCodeAlone(t *testing.T) {
+	h, _ := newTestSystem()
+	if err := h.AssignPromoToUsers("HOLIDAY15", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	err := h.UpdatePromoCode("HOLIDAY15", func(p *PromoCode) {
+		p.EligibleUsers[2] = true
+		p.RoomTypes = append(p.RoomTypes, "suite")
+		p.Percentage = 150
+	})
+	if err == nil {
+		t.Fatal("invalid update accepted")
+	}
+	p := h.promoCodes["HOLIDAY15"]
+	if p.Percentage != 15 || p.EligibleUsers[2] || len(p.RoomTypes) != 0 {
+		t.Errorf("rejected update changed the code: %+v", *p)
+	}
+}
+
+func TestCheckPromoFailureModes(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	for _, p := range []PromoCode{
+		{Code: "OLD", Percentage: 5, ExpiresAt: testNow.Add(-time.Hour)},
+		{Code: "USEDUP", Percentage: 5, MaxUses: 1, Uses: 1},
+		{Code: "SUITES", Percentage: 5, RoomTypes: []string{"suite"}},
+		{Code: "BIGSPEND", Percentage: 5, MinSpend: 20000},
+		{Code: "VIPONLY", Percentage: 5, EligibleUsers: map[int]bool{99: true}},
+		{Code: "NEWBIE", Percentage: 5, FirstTimeOnly: true},
+		{Code: "GOOD", Percentage: 5, ExpiresAt: testNow.Add(time.Hour), MaxUses: 2, RoomTypes: []string{"standard"}, MinSpend: 1000},
+	} {
+		if err := h.RegisterPromoCode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	payStay(t, h, 1, standard, 1, 1)
+	b := selectStay(t, h, 1, standard, 10, 1)
+
+	for code, want := range map[string]error{
+		"NOPE":     ErrPromoNotFound,
+		"OLD":      ErrPromoExpired,
+		"USEDUP":   ErrPromoExhausted,
+		"SUITES":   ErrPromoRoomType,
+		"BIGSPEND": ErrPromoMinSpend,
+		"VIPONLY":  ErrPromoNotEligible,
+		"NEWBIE":   ErrPromoFirstTimeOnly,
+	} {
+		if err := h.CheckPromo(code, b, testNow); !errors.Is(err, want) {
+			t.Errorf("CheckPromo(%s) = %v, want %v", code, err, want)
+		}
+	}
+	if err := h.CheckPromo("GOOD", b, testNow); err != nil {
+		t.Errorf("CheckPromo(GOOD) = %v, want nil", err)
+	}
+	if err := h.CheckPromo("GOOD", b, testNow.Add(2*time.Hour)); !errors.Is(err, ErrPromoExpired) {
+		t.Errorf("CheckPromo(GOOD) later = %v, want %v", err, ErrPromoExpired)
+	}
+	if b.State != StateRoomSelected || h.promoCodes["GOOD"].Uses != 0 {
+		t.Error("CheckPromo changed the booking or the code")
+	}
+}
+
+func TestGenerateCodesAreUniqueAndRegistered(t *testing.T) {
+	h, _ := newTestSystem()
+	codes, err := h.GenerateCodes("SUMMER", 1000, 15, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 1000 {
+		t.Fatalf("generated %d codes, want 1000", len(codes))
+	}
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if seen[code] {
+			t.Fatalf("code %s generated twice", code)
+		}
+		seen[code] = true
+		p, ok := h.promoCodes[code]
+		if !ok || !strings.HasPrefix(code, "SUMMER") || p.Percentage != 15 || p.MaxUses != 1 {
+			t.Fatalf("code %s is not registered as a single-use 15%% SUMMER code", code)
+		}
+	}
+	if _, err := h.GenerateCodes("bad", 1, 15, 1); err == nil {
+		t.Error("lowercase prefix accepted")
+	}
+	if _, err := h.GenerateCodes("OK", 0, 15, 1); err == nil {
+		t.Error("zero count accepted")
+	}
+}
+
+func TestPromoAssignedToUsers(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	if err := h.AssignPromoToUsers("HOLIDAY15", []int{1, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AssignPromoToUsers("MISSING", []int{1}); !errors.Is(err, ErrPromoNotFound) {
+		t.Errorf("assigning a missing code error = %v, want %v", err, ErrPromoNotFound)
+	}
+
+	pay := func(user, from int) *Booking {
+		b := selectStay(t, h, user, room, from, 1)
+		mustTransition(t, h, b, EventConfirmBooking, nil, "")
+		mustTransition(t, h, b, EventPay, nil, "HOLIDAY15")
+		return b
+	}
+	if b := pay(1, 10); b.Total != 4250 || b.AppliedPromo != "HOLIDAY15" {
+		t.Errorf("eligible user paid %.2f with %q, want 4250 with HOLIDAY15", b.Total, b.AppliedPromo)
+	}
+	if b := pay(2, 12); b.Total != 5000 || b.AppliedPromo != "" {
+		t.Errorf("ineligible user paid %.2f with %q, want 5000 without a code", b.Total, b.AppliedPromo)
+	}
+}
+
+func TestBestPromoCombinationBeatsAllCodes(t *testing.T) {
+	h, _ := newTestSystem()
+	h.MaxDiscountPercent = 40
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	for _, p := range []PromoCode{
+		{Code: "FLASH30", Percentage: 30},
+		{Code: "STACK10", Percentage: 10, Stackable: true},
+		{Code: "STACK5", Percentage: 5, Stackable: true},
+		{Code: "SUITE50", Percentage: 50, Stackable: true, RoomTypes: []string{"suite"}},
+	} {
+		if err := h.RegisterPromoCode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := []string{"STACK10", "FLASH30", "STACK5", "SUITE50"}
+
+	everything := selectStay(t, h, 1, room, 10, 2)
+	mustTransition(t, h, everything, EventConfirmBooking, nil, "")
+	mustTransition(t, h, everything, EventPay, nil, JoinPromoCodes(all))
+	if everything.Total != 8500 || everything.AppliedPromo != "STACK10,STACK5" {
+		t.Errorf("all codes: total %.2f with %q, want 8500 with the stackable ones", everything.Total, everything.AppliedPromo)
+	}
+
+	b := selectStay(t, h, 2, room, 20, 2)
+	best, discount := h.BestPromoCombination(b, all, testNow)
+	if len(best) != 1 || best[0] != "FLASH30" || discount != 3000 {
+		t.Fatalf("BestPromoCombination = %v, %.2f; want [FLASH30], 3000", best, discount)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, JoinPromoCodes(best))
+	if b.Total != 7000 || b.Total >= everything.Total {
+		t.Errorf("best combination total = %.2f, want 7000", b.Total)
+	}
+}
+
+func TestPayWithStackedCodes(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	for _, p := range []PromoCode{
+		{Code: "STACK10", Percentage: 10, Stackable: true, MaxUses: 1},
+		{Code: "STACK300", FixedAmount: 300, Stackable: true},
+	} {
+		if err := h.RegisterPromoCode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := selectStay(t, h, 1, room, 10, 1)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "STACK10,STACK300")
+	if b.Total != 4200 || b.PromoDiscount != 800 || b.AppliedPromo != "STACK10,STACK300" {
+		t.Errorf("total %.2f, discount %.2f, codes %q; want 4200, 800, both codes", b.Total, b.PromoDiscount, b.AppliedPromo)
+	}
+	if h.promoCodes["STACK10"].Uses != 1 || h.promoCodes["STACK300"].Uses != 1 {
+		t.Error("each stacked code should count one use")
+	}
+	if usage := h.PromoUsage(); usage["STACK10"] != 1 || usage["STACK300"] != 1 {
+		t.Errorf("PromoUsage = %v, want one use of each stacked code", usage)
+	}
+
+	// STACK10 is used up, so only the fixed amount applies.
+	again := selectStay(t, h, 2, room, 12, 1)
+	mustTransition(t, h, again, EventConfirmBooking, nil, "")
+	mustTransition(t, h, again, EventPay, nil, "STACK10,STACK300")
+	if again.Total != 4700 || again.AppliedPromo != "STACK300" {
+		t.Errorf("total %.2f with %q, want 4700 with STACK300", again.Total, again.AppliedPromo)
+	}
+}
+
+func TestPromoDiscountTotal(t *testing.T) {
+	h, _ := newTestSystem()
+	h.DefaultDiscountPercent = 10
+	h.MaxDiscountPercent = 25
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	for _, p := range []PromoCode{
+		{Code: "PCT20", Percentage: 20},
+		{Code: "FIX500", FixedAmount: 500},
+	} {
+		if err := h.RegisterPromoCode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pay := func(userID, from int, code string) *Booking {
+		b := selectStay(t, h, userID, room, from, 1)
+		mustTransition(t, h, b, EventConfirmBooking, nil, "")
+		mustTransition(t, h, b, EventPay, nil, code)
+		return b
+	}
+
+	// Capped at 25%, so PCT20 only adds 15% on top of the default discount.
+	capped := pay(1, 1, "PCT20")
+	fixed := pay(2, 2, "FIX500")
+	pay(3, 3, "")
+	if capped.PromoDiscount != 750 || fixed.PromoDiscount != 500 {
+		t.Errorf("promo discounts %.0f and %.0f, want 750 and 500", capped.PromoDiscount, fixed.PromoDiscount)
+	}
+
+	unpaid := selectStay(t, h, 4, room, 4, 1)
+	mustTransition(t, h, unpaid, EventConfirmBooking, nil, "")
+	mustTransition(t, h, unpaid, EventCancel, nil, "")
+
+	if got := h.PromoDiscountTotal(); got != 1250 {
+		t.Errorf("PromoDiscountTotal() = %.0f, want 1250", got)
+	}
+}
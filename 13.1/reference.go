@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	referencePrefix = "HTL-"
+	referenceLength = 4
+	// referenceAlphabet leaves out characters that are easy to confuse,
+	// such as 0 and O or 1 and I.
+	referenceAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+func (h *HotelBookingSystem) newReference() string {
+	for {
+		code := make([]byte, referenceLength)
+		for i := range code {
+			code[i] = referenceAlphabet[rand.Intn(len(referenceAlphabet))]
+		}
+		ref := referencePrefix + string(code)
+		if _, taken := h.references[ref]; !taken {
+			return ref
+		}
+	}
+}
+
+func (h *HotelBookingSystem) GetByReference(ref string) (*Booking, error) {
+	id, ok := h.references[ref]
+	if !ok {
+		return nil, fmt.Errorf("no booking with reference %s", ref)
+	}
+	b, ok := h.bookings[id]
+	if !ok {
+		return nil, fmt.Errorf("no booking with reference %s", ref)
+	}
+	return b, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetByReference(t *testing.T) {
+	h, _ := newTestSystem()
+	seen := make(map[string]bool)
+	var bookings []*Booking
+	for user := 1; user <= 50; user++ {
+		b, err := h.NewBooking(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(b.Reference, referencePrefix) || len(b.Reference) != len(referencePrefix)+referenceLength {
+			t.Errorf("reference %q is not of the form HTL-XXXX", b.Reference)
+		}
+		if seen[b.Reference] {
+			t.Errorf("reference %s issued twice", b.Reference)
+		}
+		seen[b.Reference] = true
+		bookings = append(bookings, b)
+	}
+
+	for _, b := range bookings {
+		got, err := h.GetByReference(b.Reference)
+		if err != nil || got != b {
+			t.Errorf("GetByReference(%s) = %v, %v; want booking #%d", b.Reference, got, err, b.ID)
+		}
+	}
+	if _, err := h.GetByReference("HTL-0000"); err == nil {
+		t.Error("unknown reference found")
+	}
+}
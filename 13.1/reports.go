@@ -0,0 +1,285 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// PendingPaymentOlderThan returns confirmed bookings that have been waiting
+// for payment longer than d.
+func (h *HotelBookingSystem) PendingPaymentOlderThan(d time.Duration) []*Booking {
+	var pending []*Booking
+	for _, b := range h.sortedBookings() {
+		if b.State == StateBookingConfirmed && h.now().Sub(b.ConfirmedAt) > d {
+			pending = append(pending, b)
+		}
+	}
+	return pending
+}
+
+// RoomRevenue returns the revenue collected per room ID over the history,
+// net of refunds.
+func (h *HotelBookingSystem) RoomRevenue() map[int]float64 {
+	revenue := make(map[int]float64)
+	for _, b := range h.history.Bookings {
+		if b.Room == nil || b.Total == 0 {
+			continue
+		}
+		revenue[b.Room.ID] += b.Total - b.RefundedAmount
+	}
+	return revenue
+}
+
+// TopRooms returns up to n room IDs with the highest revenue, highest first.
+func (h *HotelBookingSystem) TopRooms(n int) []int {
+	return topByValue(h.RoomRevenue(), n)
+}
+
+// AverageStayNights returns the mean length of stay of paid bookings in the
+// history. Hourly bookings and bookings without dates are not counted.
+func (h *HotelBookingSystem) AverageStayNights() float64 {
+	total, count := 0, 0
+	for _, b := range h.history.Bookings {
+		if !b.isPaid() || !b.hasDates() || b.Kind == KindHourly {
+			continue
+		}
+		total += h.Nights(b)
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count)
+}
+
+// AverageLeadTime returns the mean time between creation and check-in of the
+// bookings in the history that were ever paid, including ones later refunded
+// or marked as no-shows.
+func (h *HotelBookingSystem) AverageLeadTime() time.Duration {
+	var total time.Duration
+	count := 0
+	for _, b := range h.history.Bookings {
+		if b.PaidAt.IsZero() || b.CheckInDate.IsZero() {
+			continue
+		}
+		total += b.CheckInDate.Sub(b.CreatedAt)
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+// CancellationLeadTimes returns, for each cancelled booking with dates in the
+// history, how long before check-in it was cancelled.
+func (h *HotelBookingSystem) CancellationLeadTimes() []time.Duration {
+	var leadTimes []time.Duration
+	for _, b := range h.history.Bookings {
+		if b.State != StateBookingCancelled || !b.hasDates() {
+			continue
+		}
+		leadTimes = append(leadTimes, b.CheckInDate.Sub(b.CancelledAt))
+	}
+	return leadTimes
+}
+
+// ProjectedRevenue returns the expected revenue of confirmed and paid
+// bookings checking in within [from, to). Unpaid bookings are counted at
+// their current price before discounts.
+func (h *HotelBookingSystem) ProjectedRevenue(from, to time.Time) float64 {
+	total := 0.0
+	for _, b := range h.bookings {
+		if !b.hasDates() || b.CheckInDate.Before(from) || !b.CheckInDate.Before(to) {
+			continue
+		}
+		switch {
+		case b.isPaid():
+			total += b.NetTotal()
+		case b.State == StateBookingConfirmed:
+			total += h.subtotal(b)
+		}
+	}
+	return total
+}
+
+// UserLifetimeValue sums what the user has paid across the history, net of
+// refunds and credits.
+func (h *HotelBookingSystem) UserLifetimeValue(userID int) float64 {
+	return h.lifetimeValues()[userID]
+}
+
+func (h *HotelBookingSystem) lifetimeValues() map[int]float64 {
+	values := make(map[int]float64)
+	for _, b := range h.history.Bookings {
+		if !b.PaidAt.IsZero() {
+			values[b.UserID] += b.NetTotal()
+		}
+	}
+	return values
+}
+
+// TopCustomers returns up to n user IDs with the highest lifetime value,
+// highest first.
+func (h *HotelBookingSystem) TopCustomers(n int) []int {
+	return topByValue(h.lifetimeValues(), n)
+}
+
+// topByValue returns up to n keys with the highest values, highest first and
+// by ascending key on ties.
+func topByValue(values map[int]float64, n int) []int {
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if values[ids[i]] != values[ids[j]] {
+			return values[ids[i]] > values[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if n < 0 {
+		n = 0
+	}
+	if n < len(ids) {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+// BookingsPerDay counts the bookings created on each hotel-local date from
+// from to to inclusive. Dates are keyed as midnight UTC and every date in the
+// range is present, with zero when nothing was booked.
+func (h *HotelBookingSystem) BookingsPerDay(from, to time.Time) map[time.Time]int {
+	counts := make(map[time.Time]int)
+	first, last := h.localDay(from), h.localDay(to)
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		counts[d] = 0
+	}
+	for _, b := range h.bookings {
+		day := h.localDay(b.CreatedAt)
+		if _, inRange := counts[day]; inRange {
+			counts[day]++
+		}
+	}
+	return counts
+}
+
+// AgentCommission sums the commission earned by the agent on paid bookings
+// in the history. Bookings refunded in full, including approved
+// cancellations, earn no commission.
+func (h *HotelBookingSystem) AgentCommission(agentID int) float64 {
+	total := 0.0
+	for _, b := range h.history.Bookings {
+		if b.AgentID == agentID && !b.PaidAt.IsZero() && b.RefundedAmount < b.Total {
+			total += b.Commission
+		}
+	}
+	return total
+}
+
+// forecastWeeks is how many past weeks DemandForecast averages over.
+const forecastWeeks = 4
+
+// DemandForecast predicts the occupancy of roomType on date as the plain
+// average of its occupancy on the same weekday in each of the forecastWeeks
+// weeks before date.
+func (h *HotelBookingSystem) DemandForecast(roomType string, date time.Time) float64 {
+	day := h.localDay(date)
+	total := 0.0
+	for week := 1; week <= forecastWeeks; week++ {
+		total += h.typeOccupancy(roomType, day.AddDate(0, 0, -7*week))
+	}
+	return total / forecastWeeks
+}
+
+// typeOccupancy returns the share of rooms of roomType held on the night of
+// day, a hotel-local date as returned by localDay.
+func (h *HotelBookingSystem) typeOccupancy(roomType string, day time.Time) float64 {
+	rooms := 0
+	for _, r := range h.rooms {
+		if r.Type == roomType {
+			rooms++
+		}
+	}
+	if rooms == 0 {
+		return 0
+	}
+	occupied := make(map[int]bool)
+	for _, b := range h.bookings {
+		if !b.holdsRoom() || b.Room.Type != roomType {
+			continue
+		}
+		if _, known := h.rooms[b.Room.ID]; !known {
+			continue
+		}
+		for _, d := range h.stayDays(b) {
+			if d.Equal(day) {
+				occupied[b.Room.ID] = true
+				break
+			}
+		}
+	}
+	return float64(len(occupied)) / float64(rooms)
+}
+
+// BreakEvenOccupancy returns the share of roomCount rooms that must be sold
+// each night at avgNightlyRevenue to cover fixedCosts per night. A result
+// above 1 means the hotel cannot break even; without revenue it is +Inf.
+func BreakEvenOccupancy(fixedCosts float64, avgNightlyRevenue float64, roomCount int) float64 {
+	if fixedCosts <= 0 {
+		return 0
+	}
+	capacity := avgNightlyRevenue * float64(roomCount)
+	if capacity <= 0 {
+		return math.Inf(1)
+	}
+	return fixedCosts / capacity
+}
+
+// NoShowRatePerType returns, for each room type, the share of bookings in
+// the history that ended as no-shows among those whose guest was due to
+// arrive: the checked-in and no-show ones.
+func (h *HotelBookingSystem) NoShowRatePerType() map[string]float64 {
+	arrivals := make(map[string]int)
+	noShows := make(map[string]int)
+	for _, b := range h.history.Bookings {
+		if b.Room == nil || (b.State != StateCheckedIn && b.State != StateNoShow) {
+			continue
+		}
+		arrivals[b.Room.Type]++
+		if b.State == StateNoShow {
+			noShows[b.Room.Type]++
+		}
+	}
+	rates := make(map[string]float64, len(arrivals))
+	for roomType, n := range arrivals {
+		rates[roomType] = float64(noShows[roomType]) / float64(n)
+	}
+	return rates
+}
+
+// RepeatGuestRate returns the share of distinct users in the history who
+// have paid for more than one booking.
+func (h *HotelBookingSystem) RepeatGuestRate() float64 {
+	paid := make(map[int]int)
+	for _, b := range h.history.Bookings {
+		if _, seen := paid[b.UserID]; !seen {
+			paid[b.UserID] = 0
+		}
+		if !b.PaidAt.IsZero() {
+			paid[b.UserID]++
+		}
+	}
+	if len(paid) == 0 {
+		return 0
+	}
+	repeat := 0
+	for _, n := range paid {
+		if n > 1 {
+			repeat++
+		}
+	}
+	return float64(repeat) / float64(len(paid))
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPendingPaymentOlderThan(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	stale := selectStay(t, h, 1, room, 10, 1)
+	mustTransition(t, h, stale, EventConfirmBooking, nil, "")
+	paid := payStay(t, h, 2, room, 12, 1)
+
+	clock.Advance(3 * time.Hour)
+	fresh := selectStay(t, h, 3, room, 14, 1)
+	mustTransition(t, h, fresh, EventConfirmBooking, nil, "")
+	clock.Advance(30 * time.Minute)
+
+	got := h.PendingPaymentOlderThan(2 * time.Hour)
+	if len(got) != 1 || got[0] != stale {
+		t.Errorf("PendingPaymentOlderThan = %d bookings, want only #%d (paid #%d, fresh #%d excluded)",
+			len(got), stale.ID, paid.ID, fresh.ID)
+	}
+}
+
+func TestRoomRevenueAndTopRooms(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	deluxe := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	suite := addRoom(t, h, &Room{ID: 301, Type: "suite", Price: 20000})
+	payStay(t, h, 1, standard, 10, 3)
+	payStay(t, h, 2, standard, 13, 1)
+	payStay(t, h, 3, deluxe, 10, 1)
+	refunded := payStay(t, h, 4, suite, 10, 1)
+	mustTransition(t, h, refunded, EventRefund, nil, "")
+	cancelled := selectStay(t, h, 5, suite, 20, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+
+	revenue := h.RoomRevenue()
+	if revenue[101] != 20000 || revenue[201] != 10000 || revenue[301] != 0 {
+		t.Errorf("RoomRevenue = %v, want 101:20000 201:10000 301:0", revenue)
+	}
+	top := h.TopRooms(2)
+	if len(top) != 2 || top[0] != 101 || top[1] != 201 {
+		t.Errorf("TopRooms(2) = %v, want [101 201]", top)
+	}
+}
+
+func TestAverageStayNights(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000, HourlyRate: 900})
+	payStay(t, h, 1, room, 10, 2)
+	payStay(t, h, 2, room, 12, 4)
+	mustTransition(t, h, payStay(t, h, 3, room, 16, 3), EventCheckIn, nil, "")
+
+	cancelled := selectStay(t, h, 4, room, 30, 10)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+	undated, _ := h.NewBooking(5)
+	mustTransition(t, h, undated, EventSelectRoom, room, "")
+	mustTransition(t, h, undated, EventConfirmBooking, nil, "")
+	mustTransition(t, h, undated, EventPay, nil, "")
+
+	if got := h.AverageStayNights(); got != 3 {
+		t.Errorf("AverageStayNights = %v, want 3", got)
+	}
+}
+
+func TestCancellationLeadTimes(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	early := selectStay(t, h, 1, room, 10, 1)
+	late := selectStay(t, h, 2, room, 3, 1)
+	payStay(t, h, 3, room, 20, 1)
+
+	mustTransition(t, h, early, EventCancel, nil, "")
+	clock.Advance(24 * time.Hour)
+	mustTransition(t, h, late, EventCancel, nil, "")
+	// A rejected second cancel leaves the recorded cancellation alone.
+	clock.Advance(48 * time.Hour)
+	if err := h.Transition(early, EventCancel, nil, ""); err == nil {
+		t.Fatal("cancelling a cancelled booking succeeded")
+	}
+
+	got := h.CancellationLeadTimes()
+	want := []time.Duration{day(10).Sub(testNow), day(3).Sub(testNow.Add(24 * time.Hour))}
+	if len(got) != len(want) {
+		t.Fatalf("CancellationLeadTimes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("lead time %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProjectedRevenue(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	paid := payStay(t, h, 1, room, 10, 2)
+	confirmed := selectStay(t, h, 2, room, 12, 1)
+	mustTransition(t, h, confirmed, EventConfirmBooking, nil, "")
+	selectStay(t, h, 3, room, 14, 1)
+	payStay(t, h, 4, room, 40, 1)
+
+	if got := h.ProjectedRevenue(day(7), day(21)); got != 15000 {
+		t.Errorf("ProjectedRevenue = %.2f, want 15000 from the paid and confirmed bookings", got)
+	}
+	realized := 0.0
+	for _, b := range h.history.Bookings {
+		realized += b.NetTotal()
+	}
+	if realized != paid.Total+5000 {
+		t.Errorf("realized revenue = %.2f, want %.2f from paid bookings only", realized, paid.Total+5000)
+	}
+}
+
+func TestUserLifetimeValueAndTopCustomers(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	payStay(t, h, 1, room, 10, 2)
+	credited := payStay(t, h, 1, room, 12, 1)
+	if err := h.ApplyCredit(credited, 1000, "late room"); err != nil {
+		t.Fatal(err)
+	}
+	payStay(t, h, 2, room, 14, 3)
+	refunded := payStay(t, h, 3, room, 20, 4)
+	mustTransition(t, h, refunded, EventRefund, nil, "")
+	cancelled := selectStay(t, h, 4, room, 30, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+
+	for user, want := range map[int]float64{1: 14000, 2: 15000, 3: 0, 4: 0} {
+		if got := h.UserLifetimeValue(user); got != want {
+			t.Errorf("UserLifetimeValue(%d) = %.2f, want %.2f", user, got, want)
+		}
+	}
+	if top := h.TopCustomers(2); len(top) != 2 || top[0] != 2 || top[1] != 1 {
+		t.Errorf("TopCustomers(2) = %v, want [2 1]", top)
+	}
+}
+
+func TestBookingsPerDayIncludesEmptyDays(t *testing.T) {
+	h, clock := newTestSystem()
+	h.NewBooking(1)
+	h.NewBooking(2)
+	clock.Advance(2 * 24 * time.Hour)
+	h.NewBooking(3)
+	clock.Advance(5 * 24 * time.Hour)
+	h.NewBooking(4)
+
+	got := h.BookingsPerDay(day(0), day(3))
+	want := map[time.Time]int{day(0): 2, day(1): 0, day(2): 1, day(3): 0}
+	if len(got) != len(want) {
+		t.Fatalf("BookingsPerDay = %v, want %v", got, want)
+	}
+	for d, n := range want {
+		if got[d] != n {
+			t.Errorf("bookings on %s = %d, want %d", d.Format(dateLayout), got[d], n)
+		}
+	}
+}
+
+func TestAgentCommissionOverHistory(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	book := func(user, agent, from, nights int) *Booking {
+		b := selectStay(t, h, user, room, from, nights)
+		b.AgentID = agent
+		mustTransition(t, h, b, EventConfirmBooking, nil, "")
+		mustTransition(t, h, b, EventPay, nil, "")
+		return b
+	}
+	first := book(1, 7, 10, 2)
+	book(2, 7, 12, 1)
+	mustTransition(t, h, book(3, 7, 20, 3), EventRefund, nil, "")
+	h.CancelApprovalThreshold = 12000
+	approved := book(6, 7, 25, 3)
+	mustTransition(t, h, approved, EventRequestCancel, nil, "")
+	mustTransition(t, h, approved, EventApproveCancel, nil, "")
+	book(4, 8, 30, 1)
+	payStay(t, h, 5, room, 40, 1)
+
+	if first.Commission != 800 {
+		t.Errorf("commission on 10000 = %.2f, want 800", first.Commission)
+	}
+	if got := h.AgentCommission(7); got != 1200 {
+		t.Errorf("AgentCommission(7) = %.2f, want 1200", got)
+	}
+	if got := h.AgentCommission(8); got != 400 {
+		t.Errorf("AgentCommission(8) = %.2f, want 400", got)
+	}
+}
+
+func TestDemandForecastAveragesSameWeekday(t *testing.T) {
+	h, _ := newTestSystem()
+	a := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	suite := addRoom(t, h, &Room{ID: 301, Type: "suite", Price: 20000})
+	payStay(t, h, 1, a, 0, 1)
+	payStay(t, h, 2, a, 14, 1)
+	payStay(t, h, 3, b, 13, 2)
+	payStay(t, h, 4, b, 21, 1)
+	payStay(t, h, 5, a, 22, 1)
+	payStay(t, h, 6, suite, 7, 1)
+
+	// Same weekday 1 to 4 weeks back: days 21, 14, 7 and 0 at 0.5, 1, 0, 0.5.
+	if got := h.DemandForecast("standard", day(28)); got != 0.5 {
+		t.Errorf("DemandForecast(standard) = %v, want 0.5", got)
+	}
+	if got := h.DemandForecast("suite", day(28)); got != 0.25 {
+		t.Errorf("DemandForecast(suite) = %v, want 0.25", got)
+	}
+	if got := h.DemandForecast("penthouse", day(28)); got != 0 {
+		t.Errorf("DemandForecast(penthouse) = %v, want 0", got)
+	}
+}
+
+func TestBreakEvenOccupancy(t *testing.T) {
+	for _, tt := range []struct {
+		costs, revenue float64
+		rooms          int
+		want           float64
+	}{
+		{30000, 5000, 10, 0.6},
+		{50000, 5000, 10, 1},
+		{60000, 5000, 10, 1.2},
+		{0, 5000, 10, 0},
+	} {
+		if got := BreakEvenOccupancy(tt.costs, tt.revenue, tt.rooms); got != tt.want {
+			t.Errorf("BreakEvenOccupancy(%v, %v, %d) = %v, want %v", tt.costs, tt.revenue, tt.rooms, got, tt.want)
+		}
+	}
+	if got := BreakEvenOccupancy(30000, 0, 10); !math.IsInf(got, 1) {
+		t.Errorf("BreakEvenOccupancy without revenue = %v, want +Inf", got)
+	}
+}
+
+func TestNoShowRatePerType(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	deluxe := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	outcome := func(user int, room *Room, from int, event BookingEvent) {
+		b := payStay(t, h, user, room, from, 1)
+		if event != "" {
+			mustTransition(t, h, b, event, nil, "")
+		}
+	}
+	outcome(1, standard, 1, EventNoShow)
+	outcome(2, standard, 2, EventCheckIn)
+	outcome(3, standard, 3, EventCheckIn)
+	outcome(4, standard, 4, EventCheckIn)
+	outcome(5, deluxe, 1, EventNoShow)
+	outcome(6, deluxe, 2, EventCheckIn)
+	outcome(7, deluxe, 3, "")
+	outcome(8, deluxe, 4, EventRefund)
+
+	rates := h.NoShowRatePerType()
+	if len(rates) != 2 || rates["standard"] != 0.25 || rates["deluxe"] != 0.5 {
+		t.Errorf("NoShowRatePerType = %v, want standard 0.25 and deluxe 0.5", rates)
+	}
+}
+
+func TestAverageLeadTime(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	clock.now = day(0)
+	payStay(t, h, 1, room, 10, 1)
+	clock.now = day(2)
+	mustTransition(t, h, payStay(t, h, 2, room, 6, 1), EventRefund, nil, "")
+	cancelled := selectStay(t, h, 3, room, 30, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+
+	// 10 and 4 days ahead; the cancelled booking was never paid.
+	if got, want := h.AverageLeadTime(), 7*24*time.Hour; got != want {
+		t.Errorf("AverageLeadTime = %s, want %s", got, want)
+	}
+}
+
+func TestRepeatGuestRate(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	payStay(t, h, 1, room, 1, 1)
+	payStay(t, h, 1, room, 2, 1)
+	payStay(t, h, 2, room, 3, 1)
+	payStay(t, h, 3, room, 4, 1)
+	payStay(t, h, 3, room, 5, 1)
+	payStay(t, h, 3, room, 6, 1)
+	cancelled := selectStay(t, h, 4, room, 7, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+
+	if got := h.RepeatGuestRate(); got != 0.5 {
+		t.Errorf("RepeatGuestRate = %v, want 0.5", got)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type BedType string
+
+const (
+	BedKing   BedType = "king"
+	BedDouble BedType = "double"
+	BedTwin   BedType = "twin"
+)
+
+// RoomPreferences ranks rooms by floor and view. Beds, when set, is a hard
+// requirement rather than a preference.
+type RoomPreferences struct {
+	MinFloor int
+	View     string
+	Beds     BedType
+}
+
+func (p RoomPreferences) allows(r *Room) bool {
+	return p.Beds == "" || r.Beds == p.Beds
+}
+
+func (p RoomPreferences) score(r *Room) int {
+	score := 0
+	if p.MinFloor > 0 && r.Floor >= p.MinFloor {
+		score++
+	}
+	if p.View != "" && r.View == p.View {
+		score++
+	}
+	return score
+}
+
+// AvailableRooms returns the rooms in the inventory that no active booking
+// holds for any part of [checkIn, checkOut), ordered by room ID.
+func (h *HotelBookingSystem) AvailableRooms(checkIn, checkOut time.Time) []*Room {
+	return h.availableRooms(&Booking{CheckInDate: checkIn, CheckOutDate: checkOut})
+}
+
+// availableRooms returns the rooms free for the stay of b, ignoring b itself.
+func (h *HotelBookingSystem) availableRooms(b *Booking) []*Room {
+	taken := make(map[int]bool)
+	for _, other := range h.bookings {
+		if other != b && other.holdsRoom() && other.overlaps(b) {
+			taken[other.Room.ID] = true
+		}
+	}
+	if h.HoldForQuote {
+		for id := range h.rooms {
+			if h.quoteHolder(id, b, h.now()) != nil {
+				taken[id] = true
+			}
+		}
+	}
+	var free []*Room
+	for id, r := range h.rooms {
+		if !taken[id] && !r.UnderMaintenance {
+			free = append(free, r)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool { return free[i].ID < free[j].ID })
+	return free
+}
+
+// AssignRoomMatching selects the available room that best matches prefs for
+// the booking's stay, or any available room when none match. Rooms without
+// the requested beds are never selected.
+func (h *HotelBookingSystem) AssignRoomMatching(b *Booking, prefs RoomPreferences) (*Room, error) {
+	var event BookingEvent
+	switch b.State {
+	case StateIdle:
+		event = EventSelectRoom
+	case StateRoomSelected:
+		event = EventChangeRoom
+	default:
+		return nil, fmt.Errorf("cannot assign a room to booking #%d in state %s", b.ID, b.State)
+	}
+
+	var best *Room
+	for _, r := range h.availableRooms(b) {
+		if !prefs.allows(r) {
+			continue
+		}
+		if best == nil || prefs.score(r) > prefs.score(best) {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no rooms available for booking #%d", b.ID)
+	}
+
+	b.Preferences = prefs
+	if err := h.Transition(b, event, best, ""); err != nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// ValidateBookings checks every active booking against the inventory and
+// reports bookings on unknown rooms or rooms under maintenance, and bookings
+// that overlap on one room.
+func (h *HotelBookingSystem) ValidateBookings() []error {
+	var errs []error
+	checked := make(map[int]bool)
+	for _, b := range h.sortedBookings() {
+		if !b.holdsRoom() {
+			continue
+		}
+		room, ok := h.rooms[b.Room.ID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("booking #%d references unknown room %d", b.ID, b.Room.ID))
+			continue
+		}
+		if room.UnderMaintenance {
+			errs = append(errs, fmt.Errorf("booking #%d is on room %d, which is under maintenance", b.ID, b.Room.ID))
+		}
+		if checked[b.Room.ID] {
+			continue
+		}
+		checked[b.Room.ID] = true
+		for _, pair := range h.FindOverlaps(b.Room.ID) {
+			errs = append(errs, fmt.Errorf("bookings #%d and #%d overlap on room %d", pair[0].ID, pair[1].ID, b.Room.ID))
+		}
+	}
+	return errs
+}
+
+const availabilitySearchDays = 365
+
+// NextAvailable returns the first start date on or after the given date from
+// which the room is free for the requested number of nights. The search
+// covers one year ahead.
+func (h *HotelBookingSystem) NextAvailable(roomID int, after time.Time, nights int) (time.Time, error) {
+	if _, ok := h.rooms[roomID]; !ok {
+		return time.Time{}, fmt.Errorf("room %d not found", roomID)
+	}
+	if nights <= 0 {
+		return time.Time{}, fmt.Errorf("nights must be positive, got %d", nights)
+	}
+	for day := 0; day < availabilitySearchDays; day++ {
+		start := after.AddDate(0, 0, day)
+		window := &Booking{CheckInDate: start, CheckOutDate: start.AddDate(0, 0, nights)}
+		if h.roomFree(roomID, window) {
+			return start, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("room %d has no %d free nights within %d days", roomID, nights, availabilitySearchDays)
+}
+
+func (h *HotelBookingSystem) roomFree(roomID int, window *Booking) bool {
+	for _, b := range h.bookings {
+		if b != window && b.holdsRoom() && b.Room.ID == roomID && b.overlaps(window) {
+			return false
+		}
+	}
+	return true
+}
+
+// CloseRoom takes a room out of the inventory for good. Its future bookings
+// are cancelled, or refunded in full when already paid, and returned.
+func (h *HotelBookingSystem) CloseRoom(roomID int, reason string) []*Booking {
+	// Remove the room first so freed bookings are not upgraded into it.
+	delete(h.rooms, roomID)
+
+	now := h.now()
+	var affected []*Booking
+	for _, b := range h.sortedBookings() {
+		if !b.holdsRoom() || b.Room.ID != roomID {
+			continue
+		}
+		if b.hasDates() && !b.CheckInDate.After(now) {
+			continue
+		}
+
+		var err error
+		if b.State == StatePaid {
+			err = h.Transition(b, EventHotelRefund, nil, "")
+		} else {
+			err = h.Transition(b, EventCancel, nil, "")
+		}
+		if err != nil {
+			fmt.Printf("Booking #%d: could not be released from room %d: %v\n", b.ID, roomID, err)
+			continue
+		}
+		affected = append(affected, b)
+	}
+	fmt.Printf("Room %d closed (%s), %d bookings affected\n", roomID, reason, len(affected))
+	return affected
+}
+
+// quoteHolder returns the unexpired quote, other than b, that holds the room
+// for dates overlapping b's stay. Quotes without dates hold the room outright.
+func (h *HotelBookingSystem) quoteHolder(roomID int, b *Booking, now time.Time) *Booking {
+	for _, other := range h.sortedBookings() {
+		if other == b || other.State != StateQuoted || other.Room == nil || other.Room.ID != roomID {
+			continue
+		}
+		if !now.Before(other.QuoteExpiresAt) {
+			continue
+		}
+		if !other.hasDates() || !b.hasDates() || other.overlaps(b) {
+			return other
+		}
+	}
+	return nil
+}
+
+// checkQuoteHold fails when HoldForQuote is set and room is held for another
+// booking's unexpired quote over b's stay.
+func (h *HotelBookingSystem) checkQuoteHold(room *Room, b *Booking) error {
+	if !h.HoldForQuote || room == nil {
+		return nil
+	}
+	if holder := h.quoteHolder(room.ID, b, h.now()); holder != nil {
+		return fmt.Errorf("room %d is held for the quote of booking #%d", room.ID, holder.ID)
+	}
+	return nil
+}
+
+func (h *HotelBookingSystem) SetMaintenance(roomID int, underMaintenance bool) error {
+	room, ok := h.rooms[roomID]
+	if !ok {
+		return fmt.Errorf("room %d not found", roomID)
+	}
+	room.UnderMaintenance = underMaintenance
+	return nil
+}
+
+// RoomStatus returns "free", "occupied" or "maintenance" for every room in
+// the inventory at the given moment.
+func (h *HotelBookingSystem) RoomStatus(on time.Time) map[int]string {
+	status := make(map[int]string, len(h.rooms))
+	for id, r := range h.rooms {
+		if r.UnderMaintenance {
+			status[id] = "maintenance"
+		} else {
+			status[id] = "free"
+		}
+	}
+	for _, b := range h.bookings {
+		if !b.holdsRoom() || !b.hasDates() || on.Before(b.CheckInDate) || !on.Before(b.CheckOutDate) {
+			continue
+		}
+		if s, ok := status[b.Room.ID]; ok && s == "free" {
+			status[b.Room.ID] = "occupied"
+		}
+	}
+	return status
+}
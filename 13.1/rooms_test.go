@@ -0,0 +1,186 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssignRoomMatchingPrefersHighFloor(t *testing.T) {
+	h, _ := newTestSystem()
+	addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000, Floor: 1})
+	high := addRoom(t, h, &Room{ID: 801, Type: "standard", Price: 5000, Floor: 8})
+	addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000, Floor: 1})
+
+	b, _ := h.NewBooking(1)
+	b.CheckInDate, b.CheckOutDate = day(10), day(12)
+	got, err := h.AssignRoomMatching(b, RoomPreferences{MinFloor: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != high || b.Room != high || b.State != StateRoomSelected {
+		t.Errorf("assigned room %d in state %s, want %d selected", got.ID, b.State, high.ID)
+	}
+
+	// With the high floor taken the preference falls back to any free room.
+	other, _ := h.NewBooking(2)
+	other.CheckInDate, other.CheckOutDate = day(11), day(13)
+	got, err = h.AssignRoomMatching(other, RoomPreferences{MinFloor: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == high {
+		t.Errorf("assigned room %d, which is already held", got.ID)
+	}
+}
+
+func TestValidateBookingsFlagsProblems(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	fixing := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	payStay(t, h, 1, room, 10, 2)
+	if errs := h.ValidateBookings(); len(errs) != 0 {
+		t.Fatalf("clean inventory reported %v", errs)
+	}
+
+	orphan := payStay(t, h, 2, room, 20, 1)
+	orphan.Room = &Room{ID: 999, Type: "standard", Price: 5000}
+	payStay(t, h, 3, fixing, 10, 2)
+	if err := h.SetMaintenance(fixing.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	overlapping := payStay(t, h, 4, room, 30, 1)
+	overlapping.CheckInDate, overlapping.CheckOutDate = day(11), day(12)
+
+	if errs := h.ValidateBookings(); len(errs) != 3 {
+		t.Errorf("ValidateBookings = %v, want orphan, maintenance and overlap errors", errs)
+	}
+}
+
+func TestNextAvailableSkipsBookedBlock(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	payStay(t, h, 1, room, 10, 5)
+	payStay(t, h, 2, room, 17, 2)
+
+	// Two free nights between the stays fit; three do not.
+	for _, tt := range []struct{ nights, want int }{{1, 15}, {2, 15}, {3, 19}} {
+		got, err := h.NextAvailable(room.ID, day(10), tt.nights)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(day(tt.want)) {
+			t.Errorf("NextAvailable(%d nights) = %s, want %s", tt.nights, got.Format(dateLayout), day(tt.want).Format(dateLayout))
+		}
+	}
+	if _, err := h.NextAvailable(999, day(10), 1); err == nil {
+		t.Error("unknown room accepted")
+	}
+}
+
+func TestCloseRoomReleasesFutureBookings(t *testing.T) {
+	h, clock := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	staying := payStay(t, h, 1, room, 1, 3)
+	pending := selectStay(t, h, 2, room, 10, 1)
+	paid := selectStay(t, h, 3, room, 12, 2)
+	if err := h.SelectRate(paid, RateNonRefundable); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, paid, EventConfirmBooking, nil, "")
+	mustTransition(t, h, paid, EventPay, nil, "")
+
+	clock.Advance(2 * 24 * time.Hour)
+	affected := h.CloseRoom(room.ID, "water damage")
+	if len(affected) != 2 || affected[0] != pending || affected[1] != paid {
+		t.Fatalf("CloseRoom affected %d bookings, want #%d and #%d", len(affected), pending.ID, paid.ID)
+	}
+	if pending.State != StateBookingCancelled {
+		t.Errorf("pending booking state = %s, want %s", pending.State, StateBookingCancelled)
+	}
+	if paid.State != StateRefunded || paid.RefundedAmount != paid.Total {
+		t.Errorf("paid booking state %s, refunded %.2f of %.2f; want a full refund", paid.State, paid.RefundedAmount, paid.Total)
+	}
+	if !paid.NonRefundable {
+		t.Error("CloseRoom changed the booking's rate to refundable")
+	}
+	if staying.State != StatePaid {
+		t.Errorf("current stay state = %s, want it left Paid", staying.State)
+	}
+	if _, ok := h.rooms[room.ID]; ok {
+		t.Error("closed room is still in the inventory")
+	}
+}
+
+func TestQuoteHoldsRoom(t *testing.T) {
+	h, clock := newTestSystem()
+	h.HoldForQuote = true
+	room := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 10000})
+	quote, _ := h.NewBooking(1)
+	quote.CheckInDate, quote.CheckOutDate = day(10), day(12)
+	mustTransition(t, h, quote, EventQuote, room, "")
+
+	rival, _ := h.NewBooking(2)
+	rival.CheckInDate, rival.CheckOutDate = day(11), day(13)
+	if err := h.Transition(rival, EventQuote, room, ""); err == nil {
+		t.Error("second quote for a held room accepted")
+	}
+	if err := h.Transition(rival, EventSelectRoom, room, ""); err == nil {
+		t.Error("held room selected by another booking")
+	}
+	if free := h.AvailableRooms(day(11), day(13)); len(free) != 0 {
+		t.Errorf("held room listed as available")
+	}
+
+	clock.Advance(h.QuoteTTL + time.Second)
+	mustTransition(t, h, rival, EventQuote, room, "")
+}
+
+func TestRoomStatusOnOneDay(t *testing.T) {
+	h, _ := newTestSystem()
+	occupied := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	free := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	broken := addRoom(t, h, &Room{ID: 103, Type: "standard", Price: 5000})
+	payStay(t, h, 1, occupied, 10, 2)
+	payStay(t, h, 2, free, 12, 1)
+	if err := h.SetMaintenance(broken.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	got := h.RoomStatus(day(11).Add(12 * time.Hour))
+	want := map[int]string{101: "occupied", 102: "free", 103: "maintenance"}
+	for id, status := range want {
+		if got[id] != status {
+			t.Errorf("room %d status = %q, want %q", id, got[id], status)
+		}
+	}
+	if got := h.RoomStatus(day(12).Add(12 * time.Hour)); got[101] != "free" || got[102] != "occupied" {
+		t.Errorf("RoomStatus on check-out day = %v, want 101 free and 102 occupied", got)
+	}
+}
+
+func TestOnlyKingBedRoomsSelected(t *testing.T) {
+	h, _ := newTestSystem()
+	addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000, Beds: BedTwin, Floor: 9})
+	king := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000, Beds: BedKing})
+	addRoom(t, h, &Room{ID: 103, Type: "standard", Price: 5000, Beds: BedDouble})
+
+	b, _ := h.NewBooking(1)
+	b.CheckInDate, b.CheckOutDate = day(10), day(12)
+	got, err := h.AssignRoomMatching(b, RoomPreferences{MinFloor: 5, Beds: BedKing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != king {
+		t.Errorf("assigned room %d, want the king room %d", got.ID, king.ID)
+	}
+
+	other, _ := h.NewBooking(2)
+	other.CheckInDate, other.CheckOutDate = day(11), day(13)
+	if _, err := h.AssignRoomMatching(other, RoomPreferences{Beds: BedKing}); err == nil {
+		t.Error("assigned a room without a king bed")
+	}
+	other.Preferences = RoomPreferences{Beds: BedKing}
+	if _, err := h.SelectRoomType(other, "standard"); err == nil {
+		t.Error("auto-selected a room without a king bed")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultCheckInTime      = 14 * time.Hour
+	defaultLateCheckInGrace = 12 * time.Hour
+)
+
+// checkInMoment returns when the guest may check in: CheckInTime after
+// midnight of the check-in day in the hotel's time zone, or the exact start
+// of an hourly booking.
+func (h *HotelBookingSystem) checkInMoment(b *Booking) time.Time {
+	if b.Kind == KindHourly {
+		return b.CheckInDate
+	}
+	y, m, d := b.CheckInDate.In(h.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, h.Location).Add(h.CheckInTime)
+}
+
+// AutoCheckIn checks in every paid booking whose check-in time has passed by
+// now and returns how many were checked in.
+func (h *HotelBookingSystem) AutoCheckIn(now time.Time) int {
+	checkedIn := 0
+	for _, b := range h.sortedBookings() {
+		if b.State != StatePaid || b.CheckInDate.IsZero() || now.Before(h.checkInMoment(b)) {
+			continue
+		}
+		if err := h.Transition(b, EventCheckIn, nil, ""); err == nil {
+			checkedIn++
+		}
+	}
+	return checkedIn
+}
+
+// ProcessNoShows marks paid bookings whose guest has not checked in within
+// LateCheckInGrace of the check-in time as no-shows and returns how many
+// were marked.
+func (h *HotelBookingSystem) ProcessNoShows(now time.Time) int {
+	noShows := 0
+	for _, b := range h.sortedBookings() {
+		if b.State != StatePaid || b.CheckInDate.IsZero() {
+			continue
+		}
+		if !now.After(h.checkInMoment(b).Add(h.LateCheckInGrace)) {
+			continue
+		}
+		if err := h.Transition(b, EventNoShow, nil, ""); err == nil {
+			noShows++
+		}
+	}
+	return noShows
+}
+
+// ChargeOverstays adds a charge to the balance due of every checked-in
+// booking for each night it has stayed past its check-out date. Nights
+// already charged are not charged again. OverstayRate is used per night, or
+// the nightly rate the stay is billed at when it is zero. It returns how many
+// bookings were charged.
+func (h *HotelBookingSystem) ChargeOverstays(now time.Time) int {
+	charged := 0
+	for _, b := range h.sortedBookings() {
+		if b.State != StateCheckedIn || !b.hasDates() || !now.After(b.CheckOutDate) {
+			continue
+		}
+		nights := int(h.localDay(now).Sub(h.localDay(b.CheckOutDate)).Hours()/24) - b.OverstayNightsCharged
+		if nights <= 0 {
+			continue
+		}
+		rate := h.OverstayRate
+		if rate == 0 {
+			rate = nightlyRate(b)
+		}
+		fee := rate * float64(nights)
+		b.BalanceDue += fee
+		b.OverstayNightsCharged += nights
+		fmt.Printf("Booking #%d: %d overstay nights charged, balance due: %.0f\n", b.ID, nights, b.BalanceDue)
+		charged++
+	}
+	return charged
+}
+
+// nightlyRate returns the rate one night of the booking is billed at: its
+// locked or negotiated rate when set, after the rate type's discount.
+// Hourly bookings fall back to the room's nightly price.
+func nightlyRate(b *Booking) float64 {
+	rate := b.Room.Price
+	if b.Kind != KindHourly && b.RoomRate > 0 {
+		rate = b.RoomRate
+	}
+	return rate * (1 - b.RateDiscountPercent/100)
+}
+
+// SplitBooking divides the booking's stay at the given date. The original
+// booking keeps its ID and the nights before at; a new booking with the same
+// room and state takes the rest. Amounts charged, paid and refunded, and
+// points earned and redeemed, are prorated by nights, and the new booking gets
+// a copy of the original's audit trail.
+func (h *HotelBookingSystem) SplitBooking(b *Booking, at time.Time) (*Booking, *Booking, error) {
+	if !b.hasDates() {
+		return nil, nil, fmt.Errorf("booking #%d has no stay dates to split", b.ID)
+	}
+	nights := h.Nights(b)
+	before := h.Nights(&Booking{CheckInDate: b.CheckInDate, CheckOutDate: at})
+	if before < 1 || before >= nights {
+		return nil, nil, fmt.Errorf("split date %s is not inside the stay of booking #%d", at.Format(dateLayout), b.ID)
+	}
+
+	second := *b
+	second.ID = h.nextBookingID
+	second.Reference = h.newReference()
+	second.CheckInDate = at
+	second.AddOns = nil
+	second.Credits = nil
+	second.GuestAges = append([]int(nil), b.GuestAges...)
+	second.Metadata = nil
+	for k, v := range b.Metadata {
+		second.SetMeta(k, v)
+	}
+	h.nextBookingID++
+
+	share := float64(before) / float64(nights)
+	prorate := func(first, rest *float64, code string) {
+		whole := *first
+		*first = RoundMoney(whole*share, code)
+		*rest = whole - *first
+	}
+	for _, amounts := range [][2]*float64{
+		{&b.Total, &second.Total},
+		{&b.Commission, &second.Commission},
+		{&b.PromoDiscount, &second.PromoDiscount},
+		{&b.GiftCardPaid, &second.GiftCardPaid},
+		{&b.RefundedAmount, &second.RefundedAmount},
+		{&b.InsuranceFee, &second.InsuranceFee},
+		{&b.UpgradeCharge, &second.UpgradeCharge},
+		{&b.ModificationFees, &second.ModificationFees},
+	} {
+		prorate(amounts[0], amounts[1], h.Currency)
+	}
+	prorate(&b.ChargedAmount, &second.ChargedAmount, b.PaymentCurrency)
+	for _, points := range [][2]*int{
+		{&b.PointsEarned, &second.PointsEarned},
+		{&b.PointsRedeemed, &second.PointsRedeemed},
+	} {
+		whole := *points[0]
+		*points[0] = int(math.Round(float64(whole) * share))
+		*points[1] = whole - *points[0]
+	}
+	// Overstays follow the final check-out, which now belongs to the second half.
+	b.BalanceDue, b.OverstayNightsCharged = 0, 0
+	b.CheckOutDate = at
+
+	h.bookings[second.ID] = &second
+	h.references[second.Reference] = second.ID
+	// The second half shares the original's lifecycle up to the split.
+	for _, e := range h.auditFor(b.ID) {
+		e.BookingID = second.ID
+		h.audit = append(h.audit, e)
+	}
+	if h.history.find(b.ID) != nil {
+		h.history.Add(&second)
+	}
+	fmt.Printf("Booking #%d split at %s into #%d and #%d\n", b.ID, at.Format(dateLayout), b.ID, second.ID)
+	return b, &second, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoCheckInAtCheckInTime(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	other := addRoom(t, h, &Room{ID: 102, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 1, 2)
+	later := payStay(t, h, 2, other, 2, 1)
+	cancelled := selectStay(t, h, 3, other, 1, 1)
+	mustTransition(t, h, cancelled, EventCancel, nil, "")
+
+	if n := h.AutoCheckIn(day(1).Add(13*time.Hour + 59*time.Minute)); n != 0 {
+		t.Errorf("AutoCheckIn before check-in time = %d, want 0", n)
+	}
+	if n := h.AutoCheckIn(day(1).Add(14 * time.Hour)); n != 1 {
+		t.Errorf("AutoCheckIn at check-in time = %d, want 1", n)
+	}
+	if b.State != StateCheckedIn || later.State != StatePaid || cancelled.State != StateBookingCancelled {
+		t.Errorf("states %s, %s, %s; want only the due booking checked in", b.State, later.State, cancelled.State)
+	}
+	if n := h.AutoCheckIn(day(1).Add(20 * time.Hour)); n != 0 {
+		t.Errorf("second AutoCheckIn = %d, want 0", n)
+	}
+}
+
+func TestNoShowAfterLateCheckInGrace(t *testing.T) {
+	h, _ := newTestSystem()
+	h.LateCheckInGrace = 6 * time.Hour
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 1, 2)
+	checkIn := day(1).Add(h.CheckInTime)
+
+	if n := h.ProcessNoShows(checkIn.Add(5 * time.Hour)); n != 0 || b.State != StatePaid {
+		t.Fatalf("within grace: %d no-shows, state %s; want 0, Paid", n, b.State)
+	}
+	if n := h.ProcessNoShows(checkIn.Add(6*time.Hour + time.Minute)); n != 1 || b.State != StateNoShow {
+		t.Errorf("beyond grace: %d no-shows, state %s; want 1, NoShow", n, b.State)
+	}
+}
+
+func TestChargeOverstaysAtStayRate(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 1, 2)
+	if err := h.SelectRate(b, RateNonRefundable); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	room.Price = 8000
+	mustTransition(t, h, b, EventPay, nil, "")
+	mustTransition(t, h, b, EventCheckIn, nil, "")
+
+	// Two nights past check-out at the locked 5000 less the 10% saver rate.
+	if n := h.ChargeOverstays(day(5).Add(10 * time.Hour)); n != 1 {
+		t.Fatalf("ChargeOverstays = %d, want 1", n)
+	}
+	if b.BalanceDue != 9000 || b.OverstayNightsCharged != 2 {
+		t.Errorf("balance %.2f for %d nights, want 9000 for 2", b.BalanceDue, b.OverstayNightsCharged)
+	}
+	if n := h.ChargeOverstays(day(5).Add(20 * time.Hour)); n != 0 || b.BalanceDue != 9000 {
+		t.Errorf("second run charged %d bookings, balance %.2f; want nothing new", n, b.BalanceDue)
+	}
+
+	h.OverstayRate = 6000
+	h.ChargeOverstays(day(6).Add(10 * time.Hour))
+	if b.BalanceDue != 15000 {
+		t.Errorf("balance with OverstayRate = %.2f, want 15000", b.BalanceDue)
+	}
+}
+
+func TestSplitFiveNightStayAtNightThree(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 5)
+	b.AgentID = 7
+	b.SetMeta("source", "phone")
+	h.PointValue = 10
+	h.AddPoints(1, 100)
+	if err := h.RedeemPoints(b, 100); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	id, points, auditLen := b.ID, b.PointsEarned, len(h.auditFor(b.ID))
+
+	first, second, err := h.SplitBooking(b, day(13))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != b || first.ID != id || second.ID == id || second.Reference == first.Reference {
+		t.Errorf("split IDs #%d/#%d, want the original #%d first and a new one second", first.ID, second.ID, id)
+	}
+	if !first.CheckOutDate.Equal(day(13)) || !second.CheckInDate.Equal(day(13)) || !second.CheckOutDate.Equal(day(15)) {
+		t.Errorf("split stays %s-%s and %s-%s, want 3 and 2 nights",
+			first.CheckInDate.Format(dateLayout), first.CheckOutDate.Format(dateLayout),
+			second.CheckInDate.Format(dateLayout), second.CheckOutDate.Format(dateLayout))
+	}
+	// 25000 less 1000 worth of points, split 3:2.
+	if first.Total != 14400 || second.Total != 9600 {
+		t.Errorf("totals %.2f and %.2f, want 14400 and 9600", first.Total, second.Total)
+	}
+	if first.Commission != 1152 || second.Commission != 768 || first.ChargedAmount != 14400 || second.ChargedAmount != 9600 {
+		t.Errorf("commission %.2f/%.2f, charged %.2f/%.2f; want 1152/768 and 14400/9600",
+			first.Commission, second.Commission, first.ChargedAmount, second.ChargedAmount)
+	}
+	if first.PointsEarned+second.PointsEarned != points {
+		t.Errorf("points %d + %d, want %d in total", first.PointsEarned, second.PointsEarned, points)
+	}
+	if first.PointsRedeemed != 60 || second.PointsRedeemed != 40 {
+		t.Errorf("points redeemed %d and %d, want 60 and 40", first.PointsRedeemed, second.PointsRedeemed)
+	}
+	if second.State != StatePaid || len(h.auditFor(second.ID)) != auditLen || h.history.find(second.ID) != second {
+		t.Errorf("second half state %s with %d audit entries, want Paid with %d and in history",
+			second.State, len(h.auditFor(second.ID)), auditLen)
+	}
+
+	second.SetMeta("source", "desk")
+	if v, _ := first.GetMeta("source"); v != "phone" {
+		t.Errorf("first half source = %q after changing the second, want phone", v)
+	}
+}
+
+func TestSplitBookingOutsideStay(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := payStay(t, h, 1, room, 10, 5)
+	for _, at := range []time.Time{day(10), day(15), day(20)} {
+		if _, _, err := h.SplitBooking(b, at); err == nil {
+			t.Errorf("split at %s accepted", at.Format(dateLayout))
+		}
+	}
+}
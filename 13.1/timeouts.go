@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// StateTimeout moves a booking to To once it has spent After in a state.
+type StateTimeout struct {
+	After time.Duration
+	To    BookingState
+}
+
+// timeoutTargets lists where a timeout may take a booking from each state.
+// Timeouts only release unpaid holds: they revert a step or cancel, and
+// never take payment or touch a paid booking.
+var timeoutTargets = map[BookingState][]BookingState{
+	StateQuoted:           {StateBookingCancelled},
+	StateRoomSelected:     {StateBookingCancelled},
+	StateOffered:          {StateRoomSelected, StateBookingCancelled},
+	StateBookingConfirmed: {StateRoomSelected, StateBookingCancelled},
+}
+
+func timeoutAllowed(from, to BookingState) bool {
+	for _, target := range timeoutTargets[from] {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HotelBookingSystem) SetStateTimeout(state BookingState, after time.Duration, to BookingState) error {
+	if after <= 0 {
+		return fmt.Errorf("timeout for %s must be positive", state)
+	}
+	if !timeoutAllowed(state, to) {
+		return fmt.Errorf("a timeout cannot move a booking from %s to %s", state, to)
+	}
+	h.timeouts[state] = StateTimeout{After: after, To: to}
+	return nil
+}
+
+// enteredStateAt returns when the booking entered its current state.
+func (h *HotelBookingSystem) enteredStateAt(b *Booking) time.Time {
+	entered := b.CreatedAt
+	for _, e := range h.auditFor(b.ID) {
+		if e.To != e.From {
+			entered = e.At
+		}
+	}
+	return entered
+}
+
+// ProcessTimeouts applies the configured timeout to every booking that has
+// been in its state for too long by now and returns how many were moved.
+func (h *HotelBookingSystem) ProcessTimeouts(now time.Time) int {
+	moved := 0
+	for _, b := range h.sortedBookings() {
+		timeout, ok := h.timeouts[b.State]
+		if !ok || now.Sub(h.enteredStateAt(b)) < timeout.After {
+			continue
+		}
+		if err := h.Transition(b, EventTimeout, nil, ""); err == nil {
+			moved++
+		}
+	}
+	return moved
+}
+
+// holdDeadline returns when the booking's current hold runs out: the quote
+// expiry for quoted bookings, or the end of the timeout set for its state.
+func (h *HotelBookingSystem) holdDeadline(b *Booking) (time.Time, bool) {
+	if b.State == StateQuoted {
+		return b.QuoteExpiresAt, true
+	}
+	if timeout, ok := h.timeouts[b.State]; ok {
+		return h.enteredStateAt(b).Add(timeout.After), true
+	}
+	return time.Time{}, false
+}
+
+// ExpiringSoon returns bookings whose hold has not yet run out by now but
+// will within the given window.
+func (h *HotelBookingSystem) ExpiringSoon(within time.Duration, now time.Time) []*Booking {
+	var expiring []*Booking
+	for _, b := range h.sortedBookings() {
+		deadline, ok := h.holdDeadline(b)
+		if ok && deadline.After(now) && !deadline.After(now.Add(within)) {
+			expiring = append(expiring, b)
+		}
+	}
+	return expiring
+}
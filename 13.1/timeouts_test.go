@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfirmedBookingRevertsAfterTimeout(t *testing.T) {
+	h, clock := newTestSystem()
+	if err := h.SetStateTimeout(StateBookingConfirmed, 15*time.Minute, StateRoomSelected); err != nil {
+		t.Fatal(err)
+	}
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	b := selectStay(t, h, 1, room, 10, 1)
+	clock.Advance(time.Minute)
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+
+	if n := h.ProcessTimeouts(clock.Now().Add(14 * time.Minute)); n != 0 {
+		t.Fatalf("ProcessTimeouts before the timeout = %d, want 0", n)
+	}
+	clock.Advance(15 * time.Minute)
+	if n := h.ProcessTimeouts(clock.Now()); n != 1 {
+		t.Fatalf("ProcessTimeouts after the timeout = %d, want 1", n)
+	}
+	if b.State != StateRoomSelected || !b.ConfirmedAt.IsZero() || b.RoomRate != 0 {
+		t.Errorf("state %s, ConfirmedAt %v, RoomRate %.2f; want RoomSelected with nothing locked",
+			b.State, b.ConfirmedAt, b.RoomRate)
+	}
+
+	// The reverted booking confirms again at the room's current price.
+	room.Price = 6000
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "")
+	if b.Total != 6000 {
+		t.Errorf("total after reconfirming = %.2f, want 6000", b.Total)
+	}
+}
+
+func TestTimeoutsOnlyReleaseUnpaidHolds(t *testing.T) {
+	h, _ := newTestSystem()
+	for _, tt := range []struct {
+		from, to BookingState
+	}{
+		{StateBookingConfirmed, StatePaid},
+		{StatePaid, StateRefunded},
+		{StateRoomSelected, StateBookingConfirmed},
+		{StateIdle, StateBookingCancelled},
+	} {
+		if err := h.SetStateTimeout(tt.from, time.Minute, tt.to); err == nil {
+			t.Errorf("timeout from %s to %s accepted", tt.from, tt.to)
+		}
+	}
+	if err := h.SetStateTimeout(StateRoomSelected, 0, StateBookingCancelled); err == nil {
+		t.Error("zero timeout accepted")
+	}
+	if err := h.SetStateTimeout(StateOffered, time.Hour, StateBookingCancelled); err != nil {
+		t.Errorf("offer timeout rejected: %v", err)
+	}
+}
+
+func TestExpiringSoon(t *testing.T) {
+	h, clock := newTestSystem()
+	if err := h.SetStateTimeout(StateBookingConfirmed, time.Hour, StateRoomSelected); err != nil {
+		t.Fatal(err)
+	}
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	old := selectStay(t, h, 1, room, 10, 1)
+	mustTransition(t, h, old, EventConfirmBooking, nil, "")
+	quote, _ := h.NewBooking(2)
+	mustTransition(t, h, quote, EventQuote, room, "")
+	clock.Advance(40 * time.Minute)
+	fresh := selectStay(t, h, 3, room, 12, 1)
+	mustTransition(t, h, fresh, EventConfirmBooking, nil, "")
+	payStay(t, h, 4, room, 14, 1)
+
+	// 25 minutes in, the quote has 5 minutes left and the old hold 35.
+	got := h.ExpiringSoon(40*time.Minute, testNow.Add(25*time.Minute))
+	if len(got) != 2 || got[0] != old || got[1] != quote {
+		t.Errorf("ExpiringSoon = %d bookings, want #%d and #%d", len(got), old.ID, quote.ID)
+	}
+	// 40 minutes in, the quote has run out, the old hold has 20 minutes left
+	// and the fresh one 60.
+	got = h.ExpiringSoon(30*time.Minute, clock.Now())
+	if len(got) != 1 || got[0] != old {
+		t.Errorf("ExpiringSoon after the quote ran out = %d bookings, want only #%d", len(got), old.ID)
+	}
+}
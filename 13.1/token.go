@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// EncodeBooking packs a booking into a URL-safe token.
+func EncodeBooking(b *Booking) (string, error) {
+	if b == nil {
+		return "", fmt.Errorf("cannot encode a nil booking")
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", fmt.Errorf("encode booking #%d: %w", b.ID, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func DecodeBooking(token string) (*Booking, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decode booking token: %w", err)
+	}
+	var b Booking
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("decode booking token: %w", err)
+	}
+	return &b, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeBookingRoundTrip(t *testing.T) {
+	h, _ := newTestSystem()
+	room := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000, Floor: 3, View: "sea"})
+	b := selectStay(t, h, 1, room, 10, 2)
+	if err := h.AddAddOn(b, AddOn{Name: "breakfast", Price: 800, PerNight: true}); err != nil {
+		t.Fatal(err)
+	}
+	b.GuestAges = []int{40, 6}
+	b.SetMeta("channel", "qr")
+	mustTransition(t, h, b, EventConfirmBooking, nil, "")
+	mustTransition(t, h, b, EventPay, nil, "LOYALTY10")
+
+	token, err := EncodeBooking(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeBooking(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Errorf("decoded booking differs:\n got %+v\nwant %+v", got, b)
+	}
+	if _, err := DecodeBooking(token[:len(token)-3] + "!!!"); err == nil {
+		t.Error("corrupt token decoded")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "fmt"
+
+type UpgradeRequest struct {
+	BookingID int
+	RoomType  string
+}
+
+func roomTypeRank(roomType string) int {
+	for i, t := range roomTypeOrder {
+		if t == roomType {
+			return i
+		}
+	}
+	return -1
+}
+
+// RequestUpgrade puts the booking on the upgrade list for a higher room type.
+// The upgrade is offered when a room of that type is freed by a cancellation.
+func (h *HotelBookingSystem) RequestUpgrade(b *Booking, roomType string) error {
+	if !b.holdsRoom() {
+		return fmt.Errorf("booking #%d has no room to upgrade", b.ID)
+	}
+	if roomTypeRank(roomType) <= roomTypeRank(b.Room.Type) {
+		return fmt.Errorf("%s is not an upgrade from %s", roomType, b.Room.Type)
+	}
+	h.upgrades = append(h.upgrades, UpgradeRequest{BookingID: b.ID, RoomType: roomType})
+	return nil
+}
+
+// offerUpgrades moves the first waiting booking that fits into the freed
+// room. A paid booking is charged the rate difference for every night on top
+// of its total; a confirmed one has its locked rate raised to the new room's
+// rate.
+func (h *HotelBookingSystem) offerUpgrades(room *Room) {
+	if _, ok := h.rooms[room.ID]; !ok {
+		return
+	}
+	remaining := h.upgrades[:0]
+	upgraded := false
+	for _, req := range h.upgrades {
+		b, ok := h.bookings[req.BookingID]
+		if !ok || !b.holdsRoom() {
+			continue
+		}
+		if upgraded || req.RoomType != room.Type || !h.roomFree(room.ID, b) {
+			remaining = append(remaining, req)
+			continue
+		}
+
+		diff := b.rateOf(room) - b.rateOf(b.Room)
+		if b.RoomRate > 0 {
+			diff = b.rateOf(room) - b.RoomRate
+			b.RoomRate = b.rateOf(room)
+		}
+		if b.isPaid() {
+			charge := diff
+			if nights := h.pricedNights(b); b.Kind != KindHourly && nights > 0 {
+				charge *= nights
+			}
+			b.Total += charge
+			b.UpgradeCharge += charge
+		}
+		fmt.Printf("Booking #%d: upgraded from room %d to room %d, difference %.0f\n", b.ID, b.Room.ID, room.ID, diff)
+		b.Room = room
+		upgraded = true
+	}
+	h.upgrades = remaining
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUpgradeWhenDeluxeFreesUp(t *testing.T) {
+	h, _ := newTestSystem()
+	standard := addRoom(t, h, &Room{ID: 101, Type: "standard", Price: 5000})
+	deluxe := addRoom(t, h, &Room{ID: 201, Type: "deluxe", Price: 8000})
+	taken := selectStay(t, h, 1, deluxe, 10, 3)
+	waiting := payStay(t, h, 2, standard, 10, 3)
+
+	if err := h.RequestUpgrade(waiting, "standard"); err == nil {
+		t.Error("upgrade request to the same room type accepted")
+	}
+	if err := h.RequestUpgrade(waiting, "deluxe"); err != nil {
+		t.Fatal(err)
+	}
+	mustTransition(t, h, taken, EventCancel, nil, "")
+
+	if waiting.Room != deluxe {
+		t.Fatalf("waiting booking is in room %d, want %d", waiting.Room.ID, deluxe.ID)
+	}
+	// The 3000 difference is charged for each of the 3 nights.
+	if waiting.UpgradeCharge != 9000 || waiting.Total != 24000 {
+		t.Errorf("upgrade charge %.2f, total %.2f; want 9000, 24000", waiting.UpgradeCharge, waiting.Total)
+	}
+	if len(h.upgrades) != 0 {
+		t.Errorf("%d upgrade requests left, want none", len(h.upgrades))
+	}
+}
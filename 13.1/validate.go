@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+// Validate returns every problem that keeps the booking from being
+// confirmed, rather than stopping at the first one.
+func (h *HotelBookingSystem) Validate(b *Booking) []error {
+	var errs []error
+	if b.Room == nil {
+		errs = append(errs, fmt.Errorf("booking #%d has no room", b.ID))
+	}
+	if !b.hasDates() {
+		errs = append(errs, fmt.Errorf("booking #%d has no stay dates", b.ID))
+	} else if !b.CheckOutDate.After(b.CheckInDate) {
+		errs = append(errs, fmt.Errorf("booking #%d checks out before it checks in", b.ID))
+	}
+	if b.Guests <= 0 && len(b.GuestAges) == 0 {
+		errs = append(errs, fmt.Errorf("booking #%d has no guests", b.ID))
+	} else if used := h.CapacityUsed(b); b.Room != nil && b.Room.Capacity > 0 && used > b.Room.Capacity {
+		errs = append(errs, fmt.Errorf("booking #%d needs %d places but room %d fits %d",
+			b.ID, used, b.Room.ID, b.Room.Capacity))
+	}
+	if b.Contact == "" {
+		errs = append(errs, fmt.Errorf("booking #%d has no contact details", b.ID))
+	}
+	return errs
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	h, _ := newTestSystem()
+	b, _ := h.NewBooking(1)
+	if errs := h.Validate(b); len(errs) != 4 {
+		t.Errorf("Validate on an empty booking = %v, want room, dates, guests and contact errors", errs)
+	}
+
+	b.Room = &Room{ID: 101, Type: "standard", Price: 5000, Capacity: 2}
+	b.CheckInDate, b.CheckOutDate = day(10), day(12)
+	b.Guests = 3
+	if errs := h.Validate(b); len(errs) != 2 {
+		t.Errorf("Validate = %v, want capacity and contact errors", errs)
+	}
+
+	b.Guests = 2
+	b.Contact = "guest@example.com"
+	if errs := h.Validate(b); len(errs) != 0 {
+		t.Errorf("Validate on a complete booking = %v, want none", errs)
+	}
+}